@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bostontrader/oktest/bookwerx"
+	"github.com/bostontrader/oktest/scenario"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Read a balance back from Bookwerx and assert that it equals the given decimal amount, such as 0.5.  The balance is that of a single Account or else the total of every account tagged with Category, optionally limited to the accounts of a single Currency, such as BTC.
+type AssertBalanceStep struct {
+	Books    string
+	Account  uint32
+	Category uint32
+	Currency string
+	Equals   string
+
+	balance *big.Rat
+	err     error
+}
+
+func (s *AssertBalanceStep) Name() string {
+	if s.Account != 0 {
+		return fmt.Sprintf("assert_balance %s account %d = %s", s.Books, s.Account, s.Equals)
+	}
+	return fmt.Sprintf("assert_balance %s category %d %s = %s", s.Books, s.Category, s.Currency, s.Equals)
+}
+
+func (s *AssertBalanceStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *AssertBalanceStep) Run(ctx *scenario.Context) error {
+
+	if (s.Account == 0) == (s.Category == 0) {
+		return fmt.Errorf("specify either an account or a category")
+	}
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+
+	if s.Account != 0 {
+		sum, err := bw.AccountBalance(s.Account)
+		if err != nil {
+			return err
+		}
+		s.balance = sum.Rat()
+		return nil
+	}
+
+	balances, err := bw.CategoryBalances(s.Category)
+	if err != nil {
+		return err
+	}
+	s.balance = new(big.Rat)
+	currencies := make(map[string]bool)
+	for _, b := range balances {
+		if s.Currency != "" && b.Account.Currency.Symbol != s.Currency {
+			continue
+		}
+		currencies[b.Account.Currency.Symbol] = true
+		s.balance.Add(s.balance, b.Sum.Rat())
+	}
+	if len(currencies) > 1 {
+		s.err = fmt.Errorf("category %d has accounts in more than one currency.  Specify one", s.Category)
+	}
+	return nil
+}
+
+func (s *AssertBalanceStep) Verify(ctx *scenario.Context) error {
+	if s.err != nil {
+		return s.err
+	}
+	expected, err := parseAmount(s.Equals)
+	if err != nil {
+		return err
+	}
+	if s.balance.Cmp(expected) != 0 {
+		return fmt.Errorf("the balance should be %s.  Instead it's %s", s.Equals, ratString(s.balance))
+	}
+	return nil
+}
+
+// Read the distributions of a transaction back from Bookwerx and assert that they are exactly the given ones, in any order.
+type AssertTransactionStep struct {
+	Books         string
+	Transaction   uint32
+	Distributions []struct {
+		Account uint32
+		Amount  string
+	}
+
+	actual []bookwerx.Distribution
+}
+
+func (s *AssertTransactionStep) Name() string {
+	return fmt.Sprintf("assert_transaction %s %d", s.Books, s.Transaction)
+}
+
+func (s *AssertTransactionStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *AssertTransactionStep) Run(ctx *scenario.Context) error {
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+	s.actual, err = bw.Distributions(s.Transaction)
+	return err
+}
+
+func (s *AssertTransactionStep) Verify(ctx *scenario.Context) error {
+
+	// Compare the distributions as sorted lists of "account amount".
+	expected := make([]string, len(s.Distributions))
+	for i, d := range s.Distributions {
+		amount, err := parseAmount(d.Amount)
+		if err != nil {
+			return err
+		}
+		expected[i] = fmt.Sprintf("%d %s", d.Account, ratString(amount))
+	}
+	actual := make([]string, len(s.actual))
+	for i, d := range s.actual {
+		actual[i] = fmt.Sprintf("%d %s", d.AccountID, ratString(bookwerx.Sum{Amount: d.Amount, Exp: d.AmountExp}.Rat()))
+	}
+	sort.Strings(expected)
+	sort.Strings(actual)
+
+	if strings.Join(expected, ", ") != strings.Join(actual, ", ") {
+		return fmt.Errorf("transaction %d should have the distributions [%s].  Instead it has [%s]", s.Transaction, strings.Join(expected, ", "), strings.Join(actual, ", "))
+	}
+	return nil
+}
+
+func parseAmount(s string) (*big.Rat, error) {
+	amount, exp, err := bookwerx.ParseDecimal(s)
+	if err != nil {
+		return nil, err
+	}
+	return bookwerx.Sum{Amount: amount, Exp: exp}.Rat(), nil
+}
+
+// Format an exact decimal without any trailing zeros.
+func ratString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	return strings.TrimRight(r.FloatString(30), "0")
+}
+
+// Check that the accounting equation, Assets = Liabilities + Equity + Revenue - Expenses, holds for each currency of the named set of books.  Each element is given as the categories whose accounts it comprises.  Every account must be tagged with exactly one of them, so that the books are complete.
+//
+// Bookwerx balances are debits minus credits, so liabilities, equity, and revenue are normally negative.  Therefore the equation holds when the balances of every element add up to zero.
+type AccountingEquationStep struct {
+	Books       string
+	Assets      []uint32
+	Liabilities []uint32
+	Equity      []uint32
+	Revenue     []uint32
+	Expenses    []uint32
+
+	// The balance of each element, by currency.
+	totals map[string]map[string]*big.Rat
+	err    error
+}
+
+var accountingElements = []string{"assets", "liabilities", "equity", "revenue", "expenses"}
+
+func (s *AccountingEquationStep) Name() string { return fmt.Sprintf("accounting_equation %s", s.Books) }
+
+func (s *AccountingEquationStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *AccountingEquationStep) Run(ctx *scenario.Context) error {
+
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+
+	element := make(map[uint32]string) // account ID -> element
+	s.totals = make(map[string]map[string]*big.Rat)
+	categories := [][]uint32{s.Assets, s.Liabilities, s.Equity, s.Revenue, s.Expenses}
+	for i, name := range accountingElements {
+		for _, category := range categories[i] {
+			balances, err := bw.CategoryBalances(category)
+			if err != nil {
+				return err
+			}
+			for _, b := range balances {
+				if other, ok := element[b.Account.ID]; ok {
+					if other != name {
+						s.err = fmt.Errorf("account %d %s is tagged as both %s and %s", b.Account.ID, b.Account.Title, other, name)
+					}
+					continue
+				}
+				element[b.Account.ID] = name
+				symbol := b.Account.Currency.Symbol
+				if s.totals[symbol] == nil {
+					s.totals[symbol] = make(map[string]*big.Rat)
+					for _, e := range accountingElements {
+						s.totals[symbol][e] = new(big.Rat)
+					}
+				}
+				s.totals[symbol][name].Add(s.totals[symbol][name], b.Sum.Rat())
+			}
+		}
+	}
+
+	accounts, err := bw.Accounts()
+	if err != nil {
+		return err
+	}
+	others, err := othersAccounts(bw)
+	if err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		if _, ok := element[a.ID]; !ok && !others[a.ID] && s.err == nil {
+			s.err = fmt.Errorf("account %d %s %s is not tagged as any of %s", a.ID, a.Title, a.Currency.Symbol, strings.Join(accountingElements, ", "))
+		}
+	}
+	return nil
+}
+
+// Return the accounts of the books that belong to other runs.  Runs with different run IDs may share a set of books, but each has categories of its own, with the run ID prefixed onto their symbols.  So those accounts are tagged with categories that don't have our prefix.
+func othersAccounts(bw *bookwerx.Client) (map[uint32]bool, error) {
+	others := make(map[uint32]bool)
+	if bw.Prefix == "" {
+		return others, nil
+	}
+	categories, err := bw.Categories()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range categories {
+		if strings.HasPrefix(c.Symbol, bw.Prefix) {
+			continue
+		}
+		acctcats, err := bw.Acctcats(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ac := range acctcats {
+			others[ac.AccountID] = true
+		}
+	}
+	return others, nil
+}
+
+func (s *AccountingEquationStep) Verify(ctx *scenario.Context) error {
+
+	if s.err != nil {
+		return s.err
+	}
+
+	symbols := make([]string, 0, len(s.totals))
+	for symbol := range s.totals {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	var failures []string
+	for _, symbol := range symbols {
+		t := s.totals[symbol]
+		sum := new(big.Rat)
+		for _, e := range accountingElements {
+			sum.Add(sum, t[e])
+		}
+		if sum.Sign() != 0 {
+			// Show the equation with the usual signs.
+			neg := func(r *big.Rat) string { return ratString(new(big.Rat).Neg(r)) }
+			failures = append(failures, fmt.Sprintf("%s: assets %s != liabilities %s + equity %s + revenue %s - expenses %s",
+				symbol, ratString(t["assets"]), neg(t["liabilities"]), neg(t["equity"]), neg(t["revenue"]), ratString(t["expenses"])))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("the accounting equation does not hold for the %s books: %s", s.Books, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Check that every transaction in the named set of books balances.  That is, for each currency, its distributions add up to zero.
+type DoubleEntryStep struct {
+	Books string
+
+	unbalanced []string
+}
+
+func (s *DoubleEntryStep) Name() string { return fmt.Sprintf("double_entry %s", s.Books) }
+
+func (s *DoubleEntryStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *DoubleEntryStep) Run(ctx *scenario.Context) error {
+
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+	accounts, err := bw.Accounts()
+	if err != nil {
+		return err
+	}
+	currency := make(map[uint32]string)
+	for _, a := range accounts {
+		currency[a.ID] = a.Currency.Symbol
+	}
+
+	transactions, err := bw.Transactions()
+	if err != nil {
+		return err
+	}
+	s.unbalanced = nil
+	for _, t := range transactions {
+		distributions, err := bw.Distributions(t.ID)
+		if err != nil {
+			return err
+		}
+		sums := make(map[string]*big.Rat)
+		for _, d := range distributions {
+			symbol := currency[d.AccountID]
+			if sums[symbol] == nil {
+				sums[symbol] = new(big.Rat)
+			}
+			sums[symbol].Add(sums[symbol], bookwerx.Sum{Amount: d.Amount, Exp: d.AmountExp}.Rat())
+		}
+		var off []string
+		for symbol, sum := range sums {
+			if sum.Sign() != 0 {
+				off = append(off, fmt.Sprintf("%s %s", ratString(sum), symbol))
+			}
+		}
+		if len(off) > 0 {
+			sort.Strings(off)
+			s.unbalanced = append(s.unbalanced, fmt.Sprintf("transaction %d %q at %s is off by %s", t.ID, t.Notes, t.Time, strings.Join(off, " and ")))
+		}
+	}
+	return nil
+}
+
+func (s *DoubleEntryStep) Verify(ctx *scenario.Context) error {
+	if len(s.unbalanced) > 0 {
+		return fmt.Errorf("the %s books have %d unbalanced transactions: %s", s.Books, len(s.unbalanced), strings.Join(s.unbalanced, "; "))
+	}
+	return nil
+}
+
+// Check that the OKCatbox is solvent.  That is, for each currency, the balance of the hot wallets, the accounts tagged with HotWallets, is at least the total that the OKCatbox owes its customers, in the accounts tagged with any of Customers.  If Exact then the two must be equal.
+type SolvencyStep struct {
+	Books      string
+	HotWallets uint32 `yaml:"hot_wallets"`
+	Customers  []uint32
+	Exact      bool
+
+	hot  map[string]*big.Rat
+	owed map[string]*big.Rat
+}
+
+func (s *SolvencyStep) Name() string { return fmt.Sprintf("solvency %s", s.Books) }
+
+func (s *SolvencyStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *SolvencyStep) Run(ctx *scenario.Context) error {
+
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+	if s.hot, err = balancesByCurrency(bw, s.HotWallets); err != nil {
+		return err
+	}
+
+	// Customer accounts are liabilities, so their balances are credits.
+	s.owed = make(map[string]*big.Rat)
+	for _, category := range s.Customers {
+		balances, err := balancesByCurrency(bw, category)
+		if err != nil {
+			return err
+		}
+		for symbol, b := range balances {
+			if s.owed[symbol] == nil {
+				s.owed[symbol] = new(big.Rat)
+			}
+			s.owed[symbol].Sub(s.owed[symbol], b)
+		}
+	}
+	return nil
+}
+
+func (s *SolvencyStep) Verify(ctx *scenario.Context) error {
+
+	symbols := make([]string, 0, len(s.hot)+len(s.owed))
+	for symbol := range s.hot {
+		symbols = append(symbols, symbol)
+	}
+	for symbol := range s.owed {
+		if _, ok := s.hot[symbol]; !ok {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+
+	var failures []string
+	for _, symbol := range symbols {
+		hot, owed := balance(s.hot, symbol), balance(s.owed, symbol)
+		switch c := hot.Cmp(owed); {
+		case c < 0:
+			failures = append(failures, fmt.Sprintf("%s: the hot wallets hold %s but the customers are owed %s", symbol, ratString(hot), ratString(owed)))
+		case c > 0 && s.Exact:
+			failures = append(failures, fmt.Sprintf("%s: the hot wallets hold %s but the customers are only owed %s", symbol, ratString(hot), ratString(owed)))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("the %s books are not solvent: %s", s.Books, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Assert that a program that the scenario started, such as okcatbox, logged nothing alarming during the current section.  By default that's a panic, an ERROR line, or a 5xx status code.  Forbid replaces those with other regular expressions.  Lines that match any of Allow are fine anyway.
+type AssertLogStep struct {
+	Program string
+	Forbid  []string
+	Allow   []string
+
+	found []string
+}
+
+var alarming = []string{`\bpanic:`, `\bERROR\b`, `(?i)\bstatus\W{0,3}5\d\d\b`}
+
+func (s *AssertLogStep) Name() string { return fmt.Sprintf("assert_log %s", s.Program) }
+
+func (s *AssertLogStep) Run(ctx *scenario.Context) error {
+
+	if ctx.IsDryRun() {
+		return nil // Nothing was started so nothing was logged.
+	}
+	forbid, err := compileAll(s.Forbid, alarming)
+	if err != nil {
+		return err
+	}
+	allow, err := compileAll(s.Allow, nil)
+	if err != nil {
+		return err
+	}
+	log, err := ctx.Log(s.Program)
+	if err != nil {
+		return err
+	}
+
+	s.found = nil
+	for _, line := range strings.Split(log, "\n") {
+		if matchesAny(forbid, line) && !matchesAny(allow, line) {
+			s.found = append(s.found, line)
+		}
+	}
+	return nil
+}
+
+func (s *AssertLogStep) Verify(ctx *scenario.Context) error {
+	if len(s.found) > 0 {
+		return fmt.Errorf("%s logged %d alarming lines:\n%s", s.Program, len(s.found), strings.Join(s.found, "\n"))
+	}
+	return nil
+}
+
+// Compile the regular expressions, or else the defaults.
+func compileAll(exprs, defaults []string) ([]*regexp.Regexp, error) {
+	if len(exprs) == 0 {
+		exprs = defaults
+	}
+	res := make([]*regexp.Regexp, len(exprs))
+	for i, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile %q: %v", expr, err)
+		}
+		res[i] = re
+	}
+	return res, nil
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
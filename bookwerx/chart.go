@@ -0,0 +1,130 @@
+package bookwerx
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+)
+
+// A Chart of accounts describes the currencies, categories, and accounts of a set of books, and which categories each account is tagged with.  Every account has a Name, which is how the rest of a scenario refers to it, because several accounts may have the same title.
+type Chart struct {
+	Currencies []struct {
+		Symbol string
+		Title  string
+	}
+	Categories []struct {
+		Symbol string
+		Title  string
+	}
+	Accounts []struct {
+		Name       string
+		Currency   string // The symbol of one of the Currencies.
+		Title      string
+		Categories []string // The symbols of some of the Categories.
+	}
+}
+
+// LoadChart reads a chart of accounts from a YAML file and checks that it's consistent.
+func LoadChart(fileName string) (*Chart, error) {
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var chart Chart
+	if err = yaml.Unmarshal(b, &chart); err != nil {
+		return nil, fmt.Errorf("cannot decode chart of accounts %s: %v", fileName, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range chart.Names() {
+		if seen[name] {
+			return nil, fmt.Errorf("chart of accounts %s has more than one %s", fileName, name)
+		}
+		seen[name] = true
+	}
+	for _, a := range chart.Accounts {
+		if !seen["currency."+a.Currency] {
+			return nil, fmt.Errorf("chart of accounts %s: account %s has an unknown currency %q", fileName, a.Name, a.Currency)
+		}
+		for _, symbol := range a.Categories {
+			if !seen["category."+symbol] {
+				return nil, fmt.Errorf("chart of accounts %s: account %s has an unknown category %q", fileName, a.Name, symbol)
+			}
+		}
+	}
+
+	return &chart, nil
+}
+
+// Names returns the name of everything in the chart, as used by Provision: currency.<symbol>, category.<symbol>, account.<name>, and acctcat.<account name>.<category symbol>.
+func (chart *Chart) Names() []string {
+	var names []string
+	for _, c := range chart.Currencies {
+		names = append(names, "currency."+c.Symbol)
+	}
+	for _, c := range chart.Categories {
+		names = append(names, "category."+c.Symbol)
+	}
+	for _, a := range chart.Accounts {
+		names = append(names, "account."+a.Name)
+	}
+	for _, a := range chart.Accounts {
+		for _, symbol := range a.Categories {
+			names = append(names, "acctcat."+a.Name+"."+symbol)
+		}
+	}
+	return names
+}
+
+// Provision finds or creates everything in the chart and returns the IDs, by the names that Names returns.  If saved is not nil, it's told about every ID as soon as it's known.
+func (c *Client) Provision(chart *Chart, saved func(name string, id uint32) error) (map[string]uint32, error) {
+
+	ids := make(map[string]uint32)
+	save := func(name string, id uint32) error {
+		ids[name] = id
+		if saved == nil {
+			return nil
+		}
+		return saved(name, id)
+	}
+
+	for _, currency := range chart.Currencies {
+		id, _, err := c.EnsureCurrency(currency.Symbol, currency.Title)
+		if err == nil {
+			err = save("currency."+currency.Symbol, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, category := range chart.Categories {
+		id, _, err := c.EnsureCategory(category.Symbol, category.Title)
+		if err == nil {
+			err = save("category."+category.Symbol, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, account := range chart.Accounts {
+		id, _, err := c.EnsureAccount(ids["currency."+account.Currency], account.Title)
+		if err == nil {
+			err = save("account."+account.Name, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, symbol := range account.Categories {
+			acctcat, _, err := c.EnsureTag(id, ids["category."+symbol])
+			if err == nil {
+				err = save("acctcat."+account.Name+"."+symbol, acctcat)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,231 @@
+// Package bookwerx is a client for the parts of the Bookwerx Core API that oktest uses.  Request bodies are built with url.Values so titles and notes may contain any character, and every failure is returned as an error.
+package bookwerx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// A Doer sends an HTTP request.  Both *http.Client and heimdall's *httpclient.Client are Doers.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// A Client talks to a Bookwerx Core server using a single apikey.
+type Client struct {
+	BaseURL string
+	APIKey  string
+	HTTP    Doer
+
+	// This is prefixed onto the title or notes of everything that the Client creates, and onto the symbols of categories, and EnsureAccount and EnsureCategory expect it on what they find, so that runs that share a Bookwerx server, or even a set of books, can be told apart.  Each run has categories of its own so that category balances only add up its own accounts.
+	Prefix string
+
+	// If not nil, this is told about everything that the Client creates.
+	OnCreate func(Created)
+
+	// If not nil, this is told about everything that the Client creates and then deletes again, because a transaction has to be rolled back.
+	OnDelete func(Created)
+}
+
+// ErrUnsupported is returned, wrapped, when the server has no route for a request.  Bookwerx may not be able to delete an apikey, for example.
+var ErrUnsupported = errors.New("the Bookwerx server does not support this request")
+
+// Created is a record of something that a Client created, so that it can be deleted later.
+type Created struct {
+	APIKey string
+	Kind   string // apikey, currency, account, category, acctcat, transaction, or distribution.
+	ID     uint32 `json:",omitempty"` // An apikey doesn't have one.
+}
+
+// The kinds of things that are created by posting to these paths.
+var kinds = map[string]string{
+	"/currencies":    "currency",
+	"/accounts":      "account",
+	"/categories":    "category",
+	"/acctcats":      "acctcat",
+	"/transactions":  "transaction",
+	"/distributions": "distribution",
+}
+
+// NewClient returns a Client for the server at baseURL.  The apikey may be empty if the Client will only be used to create one.
+func NewClient(baseURL, apikey string, doer Doer) *Client {
+	return &Client{BaseURL: baseURL, APIKey: apikey, HTTP: doer}
+}
+
+// LID is the response to every request that creates something.
+type LID struct {
+	LastInsertID uint32 `json:"LastInsertId"`
+}
+
+// Bookwerx reports a failure like this.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// CreateAPIKey asks the server for a new apikey.  The Client doesn't start using it by itself.
+func (c *Client) CreateAPIKey() (string, error) {
+	var response struct {
+		APIKey string `json:"apikey"`
+	}
+	if err := c.do(http.MethodPost, "/apikeys", nil, &response); err != nil {
+		return "", err
+	}
+	if response.APIKey == "" {
+		return "", fmt.Errorf("bookwerx returned an empty apikey")
+	}
+	if c.OnCreate != nil {
+		c.OnCreate(Created{APIKey: response.APIKey, Kind: "apikey"})
+	}
+	return response.APIKey, nil
+}
+
+// CreateCurrency creates a currency and returns its ID.
+func (c *Client) CreateCurrency(symbol, title string) (uint32, error) {
+	return c.Insert("/currencies", url.Values{
+		"rarity": {"0"},
+		"symbol": {symbol},
+		"title":  {c.Prefix + title},
+	})
+}
+
+// CreateAccount creates an account, using the given currency, and returns its ID.
+func (c *Client) CreateAccount(currencyID uint32, title string) (uint32, error) {
+	return c.Insert("/accounts", url.Values{
+		"currency_id": {id(currencyID)},
+		"rarity":      {"0"},
+		"title":       {c.Prefix + title},
+	})
+}
+
+// CreateCategory creates a category and returns its ID.
+func (c *Client) CreateCategory(symbol, title string) (uint32, error) {
+	return c.Insert("/categories", url.Values{
+		"symbol": {c.Prefix + symbol},
+		"title":  {c.Prefix + title},
+	})
+}
+
+// TagAccount tags an account with a category and returns the ID of the acctcat that does so.
+func (c *Client) TagAccount(accountID, categoryID uint32) (uint32, error) {
+	return c.Insert("/acctcats", url.Values{
+		"account_id":  {id(accountID)},
+		"category_id": {id(categoryID)},
+	})
+}
+
+// CreateTransaction creates a transaction, without any distributions, and returns its ID.
+func (c *Client) CreateTransaction(notes, time string) (uint32, error) {
+	return c.Insert("/transactions", url.Values{
+		"notes": {c.Prefix + notes},
+		"time":  {time},
+	})
+}
+
+// AddDistribution adds amount * 10^exp, of the account's currency, to a transaction and returns the distribution's ID.  Debits are positive and credits are negative.
+func (c *Client) AddDistribution(transactionID, accountID uint32, amount int64, exp int8) (uint32, error) {
+	return c.Insert("/distributions", url.Values{
+		"account_id":     {id(accountID)},
+		"amount":         {strconv.FormatInt(amount, 10)},
+		"amount_exp":     {strconv.Itoa(int(exp))},
+		"transaction_id": {id(transactionID)},
+	})
+}
+
+// Insert posts the form, plus the apikey, to path and returns the LastInsertID.  Use this for anything that doesn't have a method of its own.
+func (c *Client) Insert(path string, form url.Values) (uint32, error) {
+	if form.Get("apikey") == "" {
+		form.Set("apikey", c.APIKey)
+	}
+	var lid LID
+	if err := c.do(http.MethodPost, path, form, &lid); err != nil {
+		return 0, err
+	}
+	if lid.LastInsertID == 0 {
+		return 0, fmt.Errorf("POST %s: bookwerx did not return a LastInsertId", path)
+	}
+	if c.OnCreate != nil {
+		kind, ok := kinds[path]
+		if !ok {
+			kind = path
+		}
+		c.OnCreate(Created{APIKey: form.Get("apikey"), Kind: kind, ID: lid.LastInsertID})
+	}
+	return lid.LastInsertID, nil
+}
+
+// Delete deletes something that was created.  Its apikey is used, not the Client's.  An apikey can only be deleted once everything in its books has been.
+func (c *Client) Delete(created Created) error {
+	var path string
+	var form url.Values
+	switch created.Kind {
+	case "apikey":
+		path = "/apikey/" + created.APIKey
+	case "currency", "account", "category", "acctcat", "transaction", "distribution":
+		path = fmt.Sprintf("/%s/%d", created.Kind, created.ID)
+		form = url.Values{"apikey": {created.APIKey}}
+	default:
+		return fmt.Errorf("cannot delete a %s", created.Kind)
+	}
+	var response struct {
+		RowsAffected int
+	}
+	return c.do(http.MethodDelete, path, form, &response)
+}
+
+// Send a request and decode the JSON response into v.  A form is sent as the body of a POST and as the query string of anything else.
+func (c *Client) do(method, path string, form url.Values, v interface{}) error {
+
+	u := c.BaseURL + path
+	var body *strings.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+		if len(form) > 0 {
+			u += "?" + form.Encode()
+		}
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", method, path, err)
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", method, path, err)
+	}
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("%s %s: error reading the response: %v", method, path, err)
+	}
+
+	var apiErr apiError
+	if json.Unmarshal(responseBody, &apiErr) == nil && apiErr.Error != "" {
+		return fmt.Errorf("%s %s: bookwerx error: %s", method, path, apiErr.Error)
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return fmt.Errorf("%s %s: %w", method, path, ErrUnsupported)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: expected status=200, received=%d, body=%s", method, path, resp.StatusCode, string(responseBody))
+	}
+	if err := json.Unmarshal(responseBody, v); err != nil {
+		return fmt.Errorf("%s %s: JSON decode error: body=%s, err=%v", method, path, string(responseBody), err)
+	}
+	return nil
+}
+
+func id(n uint32) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
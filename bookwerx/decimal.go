@@ -0,0 +1,60 @@
+package bookwerx
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Bookwerx stores an amount as an integer and a power of ten, amount * 10^amount_exp.  These convert such a pair to and from an ordinary decimal string, such as 1.5 or 0.00000001, using exact integer arithmetic.
+
+var decimal = regexp.MustCompile(`^([+-]?)([0-9]*)(?:\.([0-9]*))?$`)
+
+// ParseDecimal converts a decimal string, such as 1.5, to an amount and an exponent, such as 15 and -1.  Trailing zeros after the decimal point are dropped, so 1.50 is also 15 and -1.
+func ParseDecimal(s string) (int64, int8, error) {
+
+	m := decimal.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || m[2]+m[3] == "" {
+		return 0, 0, fmt.Errorf("%q is not a decimal amount", s)
+	}
+	sign, whole, fraction := m[1], m[2], strings.TrimRight(m[3], "0")
+	if len(fraction) > 128 {
+		return 0, 0, fmt.Errorf("%q has too many decimal places", s)
+	}
+
+	amount, ok := new(big.Int).SetString(sign+whole+fraction, 10)
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not a decimal amount", s)
+	}
+	if !amount.IsInt64() {
+		return 0, 0, fmt.Errorf("%q has too many digits for Bookwerx", s)
+	}
+	return amount.Int64(), int8(-len(fraction)), nil
+}
+
+// FormatDecimal converts an amount and an exponent, such as 15 and -1, to a decimal string, such as 1.5.  It never uses scientific notation and it drops trailing zeros after the decimal point.
+func FormatDecimal(amount int64, exp int8) string {
+
+	digits := new(big.Int).Abs(big.NewInt(amount)).String()
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	if amount == 0 {
+		return "0"
+	}
+
+	if exp >= 0 {
+		return sign + digits + strings.Repeat("0", int(exp))
+	}
+	places := -int(exp)
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-places], strings.TrimRight(digits[len(digits)-places:], "0")
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
@@ -0,0 +1,57 @@
+package bookwerx
+
+import "testing"
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		s      string
+		amount int64
+		exp    int8
+		ok     bool
+	}{
+		{"1.5", 15, -1, true},
+		{"1.50", 15, -1, true},
+		{"0.00000001", 1, -8, true},
+		{"-2", -2, 0, true},
+		{".5", 5, -1, true},
+		{"9223372036854775807", 9223372036854775807, 0, true},
+		{"9223372036854775808", 0, 0, false},
+		{"92233720368547758.08", 0, 0, false},
+		{"1e5", 0, 0, false},
+		{"", 0, 0, false},
+		{".", 0, 0, false},
+		{"1.2.3", 0, 0, false},
+	}
+	for _, tt := range tests {
+		amount, exp, err := ParseDecimal(tt.s)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("ParseDecimal(%q) = %d, %d, expected an error", tt.s, amount, exp)
+			}
+			continue
+		}
+		if err != nil || amount != tt.amount || exp != tt.exp {
+			t.Errorf("ParseDecimal(%q) = %d, %d, %v, expected %d, %d", tt.s, amount, exp, err, tt.amount, tt.exp)
+		}
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		amount int64
+		exp    int8
+		s      string
+	}{
+		{15, -1, "1.5"},
+		{150, -2, "1.5"},
+		{1, -8, "0.00000001"},
+		{-15, -1, "-1.5"},
+		{15, 2, "1500"},
+		{0, -3, "0"},
+	}
+	for _, tt := range tests {
+		if s := FormatDecimal(tt.amount, tt.exp); s != tt.s {
+			t.Errorf("FormatDecimal(%d, %d) = %q, expected %q", tt.amount, tt.exp, s, tt.s)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package bookwerx
+
+// Empty deletes everything in the books of c.APIKey, leaves first: distributions, transactions, acctcats, accounts, categories, and then currencies.  It doesn't delete the apikey itself.  It stops at the first failure and returns how many things it deleted.  Because it finds what to delete by asking the server, it can simply be tried again.
+func (c *Client) Empty() (int, error) {
+	deleted := 0
+	del := func(kind string, id uint32) error {
+		if err := c.Delete(Created{APIKey: c.APIKey, Kind: kind, ID: id}); err != nil {
+			return err
+		}
+		deleted++
+		return nil
+	}
+
+	transactions, err := c.Transactions()
+	if err != nil {
+		return deleted, err
+	}
+	for _, t := range transactions {
+		distributions, err := c.Distributions(t.ID)
+		if err != nil {
+			return deleted, err
+		}
+		for _, d := range distributions {
+			if err := del("distribution", d.ID); err != nil {
+				return deleted, err
+			}
+		}
+		if err := del("transaction", t.ID); err != nil {
+			return deleted, err
+		}
+	}
+
+	categories, err := c.Categories()
+	if err != nil {
+		return deleted, err
+	}
+	for _, category := range categories {
+		acctcats, err := c.Acctcats(category.ID)
+		if err != nil {
+			return deleted, err
+		}
+		for _, a := range acctcats {
+			if err := del("acctcat", a.ID); err != nil {
+				return deleted, err
+			}
+		}
+	}
+
+	accounts, err := c.Accounts()
+	if err != nil {
+		return deleted, err
+	}
+	for _, a := range accounts {
+		if err := del("account", a.ID); err != nil {
+			return deleted, err
+		}
+	}
+	for _, category := range categories {
+		if err := del("category", category.ID); err != nil {
+			return deleted, err
+		}
+	}
+
+	currencies, err := c.Currencies()
+	if err != nil {
+		return deleted, err
+	}
+	for _, currency := range currencies {
+		if err := del("currency", currency.ID); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,63 @@
+package bookwerx
+
+// The Ensure methods find an existing record, or else create it, so that a set of books can be set up more than once without any duplicates.  They return the record's ID and whether or not it was created.
+
+// EnsureCurrency finds the currency with the given symbol, or else creates it.
+func (c *Client) EnsureCurrency(symbol, title string) (uint32, bool, error) {
+	currencies, err := c.Currencies()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, currency := range currencies {
+		if currency.Symbol == symbol {
+			return currency.ID, false, nil
+		}
+	}
+	id, err := c.CreateCurrency(symbol, title)
+	return id, err == nil, err
+}
+
+// EnsureAccount finds the account with the given currency and title, plus Prefix, or else creates it.
+func (c *Client) EnsureAccount(currencyID uint32, title string) (uint32, bool, error) {
+	accounts, err := c.Accounts()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, account := range accounts {
+		if account.Currency.ID == currencyID && account.Title == c.Prefix+title {
+			return account.ID, false, nil
+		}
+	}
+	id, err := c.CreateAccount(currencyID, title)
+	return id, err == nil, err
+}
+
+// EnsureCategory finds the category with the given symbol, plus Prefix, or else creates it.
+func (c *Client) EnsureCategory(symbol, title string) (uint32, bool, error) {
+	categories, err := c.Categories()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, category := range categories {
+		if category.Symbol == c.Prefix+symbol {
+			return category.ID, false, nil
+		}
+	}
+	id, err := c.CreateCategory(symbol, title)
+	return id, err == nil, err
+}
+
+// EnsureTag finds the acctcat that tags the account with the category, or else creates it.
+func (c *Client) EnsureTag(accountID, categoryID uint32) (uint32, bool, error) {
+	acctcats, err := c.Acctcats(categoryID)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, acctcat := range acctcats {
+		if acctcat.AccountID == accountID {
+			return acctcat.ID, false, nil
+		}
+	}
+	id, err := c.TagAccount(accountID, categoryID)
+	return id, err == nil, err
+}
@@ -0,0 +1,173 @@
+package bookwerx
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+)
+
+// An Account, decorated with its currency.
+type Account struct {
+	ID       uint32 `json:"id"`
+	Rarity   int    `json:"rarity"`
+	Title    string `json:"title"`
+	Currency struct {
+		ID     uint32 `json:"id"`
+		Symbol string `json:"symbol"`
+		Title  string `json:"title"`
+	} `json:"currency"`
+}
+
+type Currency struct {
+	ID     uint32 `json:"id"`
+	Rarity int    `json:"rarity"`
+	Symbol string `json:"symbol"`
+	Title  string `json:"title"`
+}
+
+type Category struct {
+	ID     uint32 `json:"id"`
+	Symbol string `json:"symbol"`
+	Title  string `json:"title"`
+}
+
+// An Acctcat tags an account with a category.
+type Acctcat struct {
+	ID         uint32 `json:"id"`
+	AccountID  uint32 `json:"account_id"`
+	CategoryID uint32 `json:"category_id"`
+}
+
+type Transaction struct {
+	ID    uint32 `json:"id"`
+	Notes string `json:"notes"`
+	Time  string `json:"time"`
+}
+
+// A Distribution is one line of a transaction.
+type Distribution struct {
+	ID            uint32 `json:"id"`
+	AccountID     uint32 `json:"account_id"`
+	Amount        int64  `json:"amount"`
+	AmountExp     int8   `json:"amount_exp"`
+	TransactionID uint32 `json:"transaction_id"`
+}
+
+// A Sum is a decimal amount, Amount * 10^Exp, such as an account balance.
+type Sum struct {
+	Amount int64 `json:"amount"`
+	Exp    int8  `json:"exp"`
+}
+
+// An AccountBalance is the balance of a single account.
+type AccountBalance struct {
+	Account Account `json:"account"`
+	Sum     Sum     `json:"sum"`
+}
+
+// Rat returns the exact value of the Sum.
+func (s Sum) Rat() *big.Rat {
+	r := new(big.Rat).SetInt64(s.Amount)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(abs(s.Exp)), nil))
+	if s.Exp < 0 {
+		return r.Quo(r, scale)
+	}
+	return r.Mul(r, scale)
+}
+
+func (s Sum) String() string { return FormatDecimal(s.Amount, s.Exp) }
+
+func abs(n int8) int64 {
+	if n < 0 {
+		return -int64(n)
+	}
+	return int64(n)
+}
+
+// Currencies returns every currency.
+func (c *Client) Currencies() ([]Currency, error) {
+	currencies := make([]Currency, 0)
+	err := c.do(http.MethodGet, "/currencies", url.Values{"apikey": {c.APIKey}}, &currencies)
+	return currencies, err
+}
+
+// Categories returns every category.
+func (c *Client) Categories() ([]Category, error) {
+	categories := make([]Category, 0)
+	err := c.do(http.MethodGet, "/categories", url.Values{"apikey": {c.APIKey}}, &categories)
+	return categories, err
+}
+
+// Acctcats returns every acctcat for the given category.
+func (c *Client) Acctcats(categoryID uint32) ([]Acctcat, error) {
+	acctcats := make([]Acctcat, 0)
+	err := c.do(http.MethodGet, "/acctcats/for_category", url.Values{
+		"apikey":      {c.APIKey},
+		"category_id": {id(categoryID)},
+	}, &acctcats)
+	return acctcats, err
+}
+
+// Accounts returns every account.
+func (c *Client) Accounts() ([]Account, error) {
+	accounts := make([]Account, 0)
+	err := c.do(http.MethodGet, "/accounts", url.Values{"apikey": {c.APIKey}}, &accounts)
+	return accounts, err
+}
+
+// Account returns the account with the given ID.
+func (c *Client) Account(accountID uint32) (*Account, error) {
+	accounts, err := c.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		if accounts[i].ID == accountID {
+			return &accounts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("account %d does not exist", accountID)
+}
+
+// AccountBalance returns the sum of every distribution of the given account.
+func (c *Client) AccountBalance(accountID uint32) (Sum, error) {
+	var response struct {
+		Sum Sum `json:"sum"`
+	}
+	err := c.do(http.MethodGet, "/account_dist_sum", url.Values{
+		"apikey":     {c.APIKey},
+		"account_id": {id(accountID)},
+	}, &response)
+	return response.Sum, err
+}
+
+// CategoryBalances returns the balance of every account that is tagged with the given category.
+func (c *Client) CategoryBalances(categoryID uint32) ([]AccountBalance, error) {
+	var response struct {
+		Sums []AccountBalance `json:"sums"`
+	}
+	err := c.do(http.MethodGet, "/category_dist_sums", url.Values{
+		"apikey":      {c.APIKey},
+		"category_id": {id(categoryID)},
+		"decorate":    {"true"},
+	}, &response)
+	return response.Sums, err
+}
+
+// Transactions returns every transaction.
+func (c *Client) Transactions() ([]Transaction, error) {
+	transactions := make([]Transaction, 0)
+	err := c.do(http.MethodGet, "/transactions", url.Values{"apikey": {c.APIKey}}, &transactions)
+	return transactions, err
+}
+
+// Distributions returns the distributions of the given transaction.
+func (c *Client) Distributions(transactionID uint32) ([]Distribution, error) {
+	distributions := make([]Distribution, 0)
+	err := c.do(http.MethodGet, "/distributions/for_tx", url.Values{
+		"apikey":         {c.APIKey},
+		"transaction_id": {id(transactionID)},
+	}, &distributions)
+	return distributions, err
+}
@@ -0,0 +1,106 @@
+package bookwerx
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// PostTransaction posts a whole transaction, with its distributions, or nothing at all.  It refuses to post distributions that don't balance, as CheckBalanced.  If Bookwerx fails partway through, whatever was already created is deleted again, so that an interrupted run doesn't leave a half-written transaction in the books.  The Distributions' IDs and TransactionIDs are ignored.  If saved is not nil then it's given the transaction's ID as soon as the transaction is created, before its distributions are.
+func (c *Client) PostTransaction(notes, time string, distributions []Distribution, saved func(uint32) error) (uint32, error) {
+	if err := c.CheckBalanced(distributions); err != nil {
+		return 0, err
+	}
+	return c.PostUnchecked(notes, time, distributions, saved)
+}
+
+// PostUnchecked is PostTransaction without the check that the distributions balance.  Use it when the accounts' currencies can't be looked up, such as in a dry run.
+func (c *Client) PostUnchecked(notes, time string, distributions []Distribution, saved func(uint32) error) (uint32, error) {
+
+	txid, err := c.CreateTransaction(notes, time)
+	if err != nil {
+		return 0, err
+	}
+	created := []Created{{APIKey: c.APIKey, Kind: "transaction", ID: txid}}
+	if saved != nil {
+		err = saved(txid)
+	}
+	for i := 0; err == nil && i < len(distributions); i++ {
+		d := distributions[i]
+		var id uint32
+		if id, err = c.AddDistribution(txid, d.AccountID, d.Amount, d.AmountExp); err == nil {
+			created = append(created, Created{APIKey: c.APIKey, Kind: "distribution", ID: id})
+		}
+	}
+	if err != nil {
+		if rollbackErr := c.rollback(created); rollbackErr != nil {
+			return 0, fmt.Errorf("%v.  Transaction %d is half-written because it cannot be rolled back: %v", err, txid, rollbackErr)
+		}
+		return 0, fmt.Errorf("%v.  Transaction %d was rolled back", err, txid)
+	}
+	return txid, nil
+}
+
+// CheckBalanced returns an error unless, for each currency, the distributions add up to zero.  Every account must be in the Client's books.
+func (c *Client) CheckBalanced(distributions []Distribution) error {
+
+	if len(distributions) == 0 {
+		return fmt.Errorf("a transaction needs some distributions")
+	}
+	accounts, err := c.Accounts()
+	if err != nil {
+		return err
+	}
+	currency := make(map[uint32]string)
+	for _, a := range accounts {
+		currency[a.ID] = a.Currency.Symbol
+	}
+
+	sums := make(map[string]*big.Rat)
+	for _, d := range distributions {
+		symbol, ok := currency[d.AccountID]
+		if !ok {
+			return fmt.Errorf("account %d is not in these books", d.AccountID)
+		}
+		if sums[symbol] == nil {
+			sums[symbol] = new(big.Rat)
+		}
+		sums[symbol].Add(sums[symbol], Sum{Amount: d.Amount, Exp: d.AmountExp}.Rat())
+	}
+	var off []string
+	for symbol, sum := range sums {
+		if sum.Sign() != 0 {
+			off = append(off, fmt.Sprintf("%s %s", sum.FloatString(int(-minExp(distributions))), symbol))
+		}
+	}
+	if len(off) > 0 {
+		sort.Strings(off)
+		return fmt.Errorf("the distributions do not balance.  They're off by %s", strings.Join(off, " and "))
+	}
+	return nil
+}
+
+// Delete what was created, most recent first, and report each deletion to OnDelete.
+func (c *Client) rollback(created []Created) error {
+	for i := len(created) - 1; i >= 0; i-- {
+		if err := c.Delete(created[i]); err != nil {
+			return err
+		}
+		if c.OnDelete != nil {
+			c.OnDelete(created[i])
+		}
+	}
+	return nil
+}
+
+// The smallest exponent of the distributions, but never more than zero, so that their sum can be printed exactly.
+func minExp(distributions []Distribution) int8 {
+	var exp int8
+	for _, d := range distributions {
+		if d.AmountExp < exp {
+			exp = d.AmountExp
+		}
+	}
+	return exp
+}
@@ -0,0 +1,365 @@
+package fakebookwerx
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+)
+
+// A Sum is a decimal amount, amount * 10^exp, as Bookwerx reports it.
+type Sum struct {
+	Amount int64 `json:"amount"`
+	Exp    int8  `json:"exp"`
+}
+
+// A decorated account, as used by category_dist_sums.
+type AccountJoined struct {
+	ID       uint32 `json:"id"`
+	APIKey   string `json:"apikey"`
+	Rarity   int    `json:"rarity"`
+	Title    string `json:"title"`
+	Currency struct {
+		ID     uint32 `json:"id"`
+		Symbol string `json:"symbol"`
+		Title  string `json:"title"`
+	} `json:"currency"`
+}
+
+type accountSum struct {
+	AccountID uint32 `json:"account_id"`
+	Sum       Sum    `json:"sum"`
+}
+
+type accountSumDecorated struct {
+	Account AccountJoined `json:"account"`
+	Sum     Sum           `json:"sum"`
+}
+
+func (s *Server) get(apikey string, segments []string, r *http.Request) (interface{}, error) {
+
+	// /<item>/<id>
+	if len(segments) == 2 && isItem(segments[0]) {
+		id, err := parseUint32("id", segments[1])
+		if err != nil {
+			return nil, err
+		}
+		item, ok := s.item(segments[0], id)
+		if !ok || item.owner() != apikey {
+			return nil, fmt.Errorf("%s %d does not exist", segments[0], id)
+		}
+		return item, nil
+	}
+
+	switch path := joinPath(segments); path {
+	case "currencies":
+		list := make([]*Currency, 0)
+		for _, c := range s.currencies {
+			if c.APIKey == apikey {
+				list = append(list, c)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		return list, nil
+
+	case "accounts":
+		list := make([]AccountJoined, 0)
+		for _, id := range s.sortedAccounts(apikey) {
+			list = append(list, s.joined(id))
+		}
+		return list, nil
+
+	case "categories":
+		list := make([]*Category, 0)
+		for _, c := range s.categories {
+			if c.APIKey == apikey {
+				list = append(list, c)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		return list, nil
+
+	case "acctcats/for_category":
+		categoryID, err := parseID(r, "category_id")
+		if err != nil {
+			return nil, err
+		}
+		list := make([]*Acctcat, 0)
+		for _, ac := range s.acctcats {
+			if ac.APIKey == apikey && ac.CategoryID == categoryID {
+				list = append(list, ac)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		return list, nil
+
+	case "transactions":
+		list := make([]*Transaction, 0)
+		for _, t := range s.transactions {
+			if t.APIKey == apikey {
+				list = append(list, t)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		return list, nil
+
+	case "distributions/for_tx", "distributions/for_account":
+		key := "transaction_id"
+		if path == "distributions/for_account" {
+			key = "account_id"
+		}
+		id, err := parseID(r, key)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]*Distribution, 0)
+		for _, d := range s.distributions {
+			if d.APIKey == apikey && (key == "transaction_id" && d.TransactionID == id || key == "account_id" && d.AccountID == id) {
+				list = append(list, d)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		return list, nil
+
+	case "account_dist_sum":
+		accountID, err := parseID(r, "account_id")
+		if err != nil {
+			return nil, err
+		}
+		if a, ok := s.accounts[accountID]; !ok || a.APIKey != apikey {
+			return nil, fmt.Errorf("account %d does not exist", accountID)
+		}
+		sum, err := s.sum(accountID, r.Form.Get("time_start"), r.Form.Get("time_stop"))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]Sum{"sum": sum}, nil
+
+	case "category_dist_sums":
+		categoryID, err := parseID(r, "category_id")
+		if err != nil {
+			return nil, err
+		}
+		decorate := r.Form.Get("decorate") == "true"
+		sums := make([]interface{}, 0)
+		for _, id := range s.sortedAccounts(apikey) {
+			if !s.tagged(id, categoryID) {
+				continue
+			}
+			sum, err := s.sum(id, r.Form.Get("time_start"), r.Form.Get("time_stop"))
+			if err != nil {
+				return nil, err
+			}
+			if decorate {
+				sums = append(sums, accountSumDecorated{s.joined(id), sum})
+			} else {
+				sums = append(sums, accountSum{id, sum})
+			}
+		}
+		return map[string]interface{}{"sums": sums}, nil
+	}
+
+	return nil, fmt.Errorf("cannot GET /%s", joinPath(segments))
+}
+
+func (s *Server) delete(apikey string, segments []string) (interface{}, error) {
+
+	if len(segments) != 2 {
+		return nil, fmt.Errorf("cannot DELETE /%s", joinPath(segments))
+	}
+	id, err := parseUint32("id", segments[1])
+	if err != nil {
+		return nil, err
+	}
+	item, ok := s.item(segments[0], id)
+	if !ok || item.owner() != apikey {
+		return nil, fmt.Errorf("%s %d does not exist", segments[0], id)
+	}
+
+	// Refuse to orphan anything, the way the foreign keys in the real database would.
+	if s.referenced(segments[0], id) {
+		return nil, fmt.Errorf("%s %d is still referenced", segments[0], id)
+	}
+
+	switch item.(type) {
+	case *Currency:
+		delete(s.currencies, id)
+	case *Account:
+		delete(s.accounts, id)
+	case *Category:
+		delete(s.categories, id)
+	case *Acctcat:
+		delete(s.acctcats, id)
+	case *Transaction:
+		delete(s.transactions, id)
+	case *Distribution:
+		delete(s.distributions, id)
+	}
+
+	return map[string]int{"RowsAffected": 1}, nil
+}
+
+// An owned record is anything that belongs to an apikey.
+type owned interface {
+	owner() string
+}
+
+func (c *Currency) owner() string     { return c.APIKey }
+func (a *Account) owner() string      { return a.APIKey }
+func (c *Category) owner() string     { return c.APIKey }
+func (ac *Acctcat) owner() string     { return ac.APIKey }
+func (t *Transaction) owner() string  { return t.APIKey }
+func (d *Distribution) owner() string { return d.APIKey }
+
+// Find a single record by its singular name, such as account, and its ID.
+func (s *Server) item(kind string, id uint32) (owned, bool) {
+	switch kind {
+	case "currency":
+		c, ok := s.currencies[id]
+		return c, ok
+	case "account":
+		a, ok := s.accounts[id]
+		return a, ok
+	case "category":
+		c, ok := s.categories[id]
+		return c, ok
+	case "acctcat":
+		ac, ok := s.acctcats[id]
+		return ac, ok
+	case "transaction":
+		t, ok := s.transactions[id]
+		return t, ok
+	case "distribution":
+		d, ok := s.distributions[id]
+		return d, ok
+	}
+	return nil, false
+}
+
+// Is the given record referred to by any other?
+func (s *Server) referenced(kind string, id uint32) bool {
+	switch kind {
+	case "currency":
+		for _, a := range s.accounts {
+			if a.CurrencyID == id {
+				return true
+			}
+		}
+	case "account":
+		for _, ac := range s.acctcats {
+			if ac.AccountID == id {
+				return true
+			}
+		}
+		for _, d := range s.distributions {
+			if d.AccountID == id {
+				return true
+			}
+		}
+	case "category":
+		for _, ac := range s.acctcats {
+			if ac.CategoryID == id {
+				return true
+			}
+		}
+	case "transaction":
+		for _, d := range s.distributions {
+			if d.TransactionID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isItem(kind string) bool {
+	switch kind {
+	case "currency", "account", "category", "acctcat", "transaction", "distribution":
+		return true
+	}
+	return false
+}
+
+func joinPath(segments []string) string {
+	path := segments[0]
+	for _, segment := range segments[1:] {
+		path += "/" + segment
+	}
+	return path
+}
+
+func (s *Server) sortedAccounts(apikey string) []uint32 {
+	ids := make([]uint32, 0)
+	for id, a := range s.accounts {
+		if a.APIKey == apikey {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (s *Server) joined(id uint32) AccountJoined {
+	a := s.accounts[id]
+	c := s.currencies[a.CurrencyID]
+	joined := AccountJoined{ID: a.ID, APIKey: a.APIKey, Rarity: a.Rarity, Title: a.Title}
+	joined.Currency.ID = c.ID
+	joined.Currency.Symbol = c.Symbol
+	joined.Currency.Title = c.Title
+	return joined
+}
+
+func (s *Server) tagged(accountID, categoryID uint32) bool {
+	for _, ac := range s.acctcats {
+		if ac.AccountID == accountID && ac.CategoryID == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// Sum the distributions of an account whose transaction time is within [start, stop].  Empty bounds are open.  Times are compared as strings, which works for the ISO 8601 times that Bookwerx uses.  It's an error if the sum doesn't fit an amount.
+func (s *Server) sum(accountID uint32, start, stop string) (Sum, error) {
+
+	// Align every amount to the smallest exponent and add them exactly.
+	exp := int8(0)
+	distributions := make([]*Distribution, 0)
+	for _, d := range s.distributions {
+		if d.AccountID != accountID {
+			continue
+		}
+		t := s.transactions[d.TransactionID].Time
+		if start != "" && t < start || stop != "" && t > stop {
+			continue
+		}
+		distributions = append(distributions, d)
+		if d.AmountExp < exp {
+			exp = d.AmountExp
+		}
+	}
+
+	total := new(big.Int)
+	ten := big.NewInt(10)
+	for _, d := range distributions {
+		scale := new(big.Int).Exp(ten, big.NewInt(int64(d.AmountExp-exp)), nil)
+		total.Add(total, new(big.Int).Mul(big.NewInt(d.Amount), scale))
+	}
+
+	// Drop trailing zeros so the result is as compact as possible.
+	if total.Sign() == 0 {
+		return Sum{0, 0}, nil
+	}
+	mod := new(big.Int)
+	for {
+		q, m := new(big.Int).QuoRem(total, ten, mod)
+		if m.Sign() != 0 {
+			break
+		}
+		total = q
+		exp++
+	}
+	if !total.IsInt64() {
+		return Sum{}, fmt.Errorf("the balance of account %d, %se%d, is too big", accountID, total, exp)
+	}
+	return Sum{total.Int64(), exp}, nil
+}
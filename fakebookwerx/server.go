@@ -0,0 +1,327 @@
+// Package fakebookwerx is an in-process stand-in for a Bookwerx Core server.  It keeps its ledger in memory and implements the subset of the Bookwerx API that oktest, okcatbox, and okconnect use so that a scenario can run without any outbound network.
+package fakebookwerx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Currency struct {
+	ID     uint32 `json:"id"`
+	APIKey string `json:"apikey"`
+	Rarity int    `json:"rarity"`
+	Symbol string `json:"symbol"`
+	Title  string `json:"title"`
+}
+
+type Account struct {
+	ID         uint32 `json:"id"`
+	APIKey     string `json:"apikey"`
+	CurrencyID uint32 `json:"currency_id"`
+	Rarity     int    `json:"rarity"`
+	Title      string `json:"title"`
+}
+
+type Category struct {
+	ID     uint32 `json:"id"`
+	APIKey string `json:"apikey"`
+	Symbol string `json:"symbol"`
+	Title  string `json:"title"`
+}
+
+type Acctcat struct {
+	ID         uint32 `json:"id"`
+	APIKey     string `json:"apikey"`
+	AccountID  uint32 `json:"account_id"`
+	CategoryID uint32 `json:"category_id"`
+}
+
+type Transaction struct {
+	ID     uint32 `json:"id"`
+	APIKey string `json:"apikey"`
+	Notes  string `json:"notes"`
+	Time   string `json:"time"`
+}
+
+type Distribution struct {
+	ID            uint32 `json:"id"`
+	APIKey        string `json:"apikey"`
+	AccountID     uint32 `json:"account_id"`
+	Amount        int64  `json:"amount"`
+	AmountExp     int8   `json:"amount_exp"`
+	TransactionID uint32 `json:"transaction_id"`
+}
+
+// A Server is a fake Bookwerx Core server.  Every record, of every kind, gets a unique ID.
+type Server struct {
+	URL string
+
+	mu            sync.Mutex
+	lastID        uint32
+	apikeys       map[string]bool
+	currencies    map[uint32]*Currency
+	accounts      map[uint32]*Account
+	categories    map[uint32]*Category
+	acctcats      map[uint32]*Acctcat
+	transactions  map[uint32]*Transaction
+	distributions map[uint32]*Distribution
+
+	listener net.Listener
+}
+
+// New returns a fake Bookwerx server that isn't listening anywhere yet.  It's an http.Handler.
+func New() *Server {
+	return &Server{
+		apikeys:       make(map[string]bool),
+		currencies:    make(map[uint32]*Currency),
+		accounts:      make(map[uint32]*Account),
+		categories:    make(map[uint32]*Category),
+		acctcats:      make(map[uint32]*Acctcat),
+		transactions:  make(map[uint32]*Transaction),
+		distributions: make(map[uint32]*Distribution),
+	}
+}
+
+// Start returns a fake Bookwerx server listening on addr, such as 127.0.0.1:0.  Its URL is set accordingly.
+func Start(addr string) (*Server, error) {
+	s := New()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.listener = listener
+	s.URL = "http://" + listener.Addr().String()
+	go func() { _ = http.Serve(listener, s) }()
+	return s, nil
+}
+
+// Close stops listening.
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// An error response, with a 400 status.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type lastInsertID struct {
+	LastInsertID uint32 `json:"LastInsertId"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if err := r.ParseForm(); err != nil {
+		reply(w, http.StatusBadRequest, apiError{err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodPost && r.URL.Path == "/apikeys" {
+		b := make([]byte, 10)
+		_, _ = rand.Read(b)
+		apikey := strings.ToUpper(hex.EncodeToString(b))
+		s.apikeys[apikey] = true
+		reply(w, http.StatusOK, map[string]string{"apikey": apikey})
+		return
+	}
+
+	// DELETE /apikey/<apikey> only works once the books are empty.
+	if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/apikey/") {
+		apikey := strings.TrimPrefix(r.URL.Path, "/apikey/")
+		if !s.apikeys[apikey] {
+			reply(w, http.StatusBadRequest, apiError{"unknown apikey"})
+			return
+		}
+		if s.owns(apikey) {
+			reply(w, http.StatusBadRequest, apiError{"the books of this apikey are not empty"})
+			return
+		}
+		delete(s.apikeys, apikey)
+		reply(w, http.StatusOK, map[string]int{"RowsAffected": 1})
+		return
+	}
+
+	apikey := r.Form.Get("apikey")
+	if !s.apikeys[apikey] {
+		reply(w, http.StatusBadRequest, apiError{"unknown apikey"})
+		return
+	}
+
+	// Every other path is /<collection> or /<item>/<id>, with optional extra segments for the queries.
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var result interface{}
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		result, err = s.post(apikey, segments[0], r)
+	case http.MethodGet:
+		result, err = s.get(apikey, segments, r)
+	case http.MethodDelete:
+		result, err = s.delete(apikey, segments)
+	default:
+		err = fmt.Errorf("method %s is not supported", r.Method)
+	}
+
+	if err != nil {
+		reply(w, http.StatusBadRequest, apiError{err.Error()})
+		return
+	}
+	reply(w, http.StatusOK, result)
+}
+
+// Does the apikey own anything at all?
+func (s *Server) owns(apikey string) bool {
+	for _, c := range s.currencies {
+		if c.APIKey == apikey {
+			return true
+		}
+	}
+	for _, c := range s.categories {
+		if c.APIKey == apikey {
+			return true
+		}
+	}
+	for _, t := range s.transactions {
+		if t.APIKey == apikey {
+			return true
+		}
+	}
+	return false
+}
+
+func reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) nextID() uint32 {
+	s.lastID++
+	return s.lastID
+}
+
+// Parse a form value, or a path segment, as an ID.
+func parseID(r *http.Request, key string) (uint32, error) {
+	return parseUint32(key, r.Form.Get(key))
+}
+
+func parseUint32(key, value string) (uint32, error) {
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an ID: %q", key, value)
+	}
+	return uint32(n), nil
+}
+
+func (s *Server) post(apikey, collection string, r *http.Request) (interface{}, error) {
+
+	id := uint32(0)
+	switch collection {
+	case "currencies":
+		rarity, _ := strconv.Atoi(r.Form.Get("rarity"))
+		symbol := r.Form.Get("symbol")
+		if symbol == "" {
+			return nil, fmt.Errorf("a currency needs a symbol")
+		}
+		for _, c := range s.currencies {
+			if c.APIKey == apikey && c.Symbol == symbol {
+				return nil, fmt.Errorf("currency %s already exists", symbol)
+			}
+		}
+		id = s.nextID()
+		s.currencies[id] = &Currency{ID: id, APIKey: apikey, Rarity: rarity, Symbol: symbol, Title: r.Form.Get("title")}
+
+	case "accounts":
+		currencyID, err := parseID(r, "currency_id")
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := s.currencies[currencyID]; !ok || c.APIKey != apikey {
+			return nil, fmt.Errorf("currency %d does not exist", currencyID)
+		}
+		rarity, _ := strconv.Atoi(r.Form.Get("rarity"))
+		id = s.nextID()
+		s.accounts[id] = &Account{ID: id, APIKey: apikey, CurrencyID: currencyID, Rarity: rarity, Title: r.Form.Get("title")}
+
+	case "categories":
+		symbol := r.Form.Get("symbol")
+		for _, c := range s.categories {
+			if c.APIKey == apikey && c.Symbol == symbol {
+				return nil, fmt.Errorf("category %s already exists", symbol)
+			}
+		}
+		id = s.nextID()
+		s.categories[id] = &Category{ID: id, APIKey: apikey, Symbol: symbol, Title: r.Form.Get("title")}
+
+	case "acctcats":
+		accountID, err := parseID(r, "account_id")
+		if err != nil {
+			return nil, err
+		}
+		categoryID, err := parseID(r, "category_id")
+		if err != nil {
+			return nil, err
+		}
+		if a, ok := s.accounts[accountID]; !ok || a.APIKey != apikey {
+			return nil, fmt.Errorf("account %d does not exist", accountID)
+		}
+		if c, ok := s.categories[categoryID]; !ok || c.APIKey != apikey {
+			return nil, fmt.Errorf("category %d does not exist", categoryID)
+		}
+		for _, ac := range s.acctcats {
+			if ac.AccountID == accountID && ac.CategoryID == categoryID {
+				return nil, fmt.Errorf("account %d is already tagged with category %d", accountID, categoryID)
+			}
+		}
+		id = s.nextID()
+		s.acctcats[id] = &Acctcat{ID: id, APIKey: apikey, AccountID: accountID, CategoryID: categoryID}
+
+	case "transactions":
+		id = s.nextID()
+		s.transactions[id] = &Transaction{ID: id, APIKey: apikey, Notes: r.Form.Get("notes"), Time: r.Form.Get("time")}
+
+	case "distributions":
+		accountID, err := parseID(r, "account_id")
+		if err != nil {
+			return nil, err
+		}
+		transactionID, err := parseID(r, "transaction_id")
+		if err != nil {
+			return nil, err
+		}
+		if a, ok := s.accounts[accountID]; !ok || a.APIKey != apikey {
+			return nil, fmt.Errorf("account %d does not exist", accountID)
+		}
+		if t, ok := s.transactions[transactionID]; !ok || t.APIKey != apikey {
+			return nil, fmt.Errorf("transaction %d does not exist", transactionID)
+		}
+		amount, err := strconv.ParseInt(r.Form.Get("amount"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("amount must be an integer: %q", r.Form.Get("amount"))
+		}
+		exp, err := strconv.ParseInt(r.Form.Get("amount_exp"), 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("amount_exp must be a small integer: %q", r.Form.Get("amount_exp"))
+		}
+		id = s.nextID()
+		s.distributions[id] = &Distribution{ID: id, APIKey: apikey, AccountID: accountID, Amount: amount, AmountExp: int8(exp), TransactionID: transactionID}
+
+	default:
+		return nil, fmt.Errorf("cannot POST to /%s", collection)
+	}
+
+	return lastInsertID{id}, nil
+}
@@ -0,0 +1,146 @@
+package fakebookwerx
+
+import (
+	"github.com/bostontrader/oktest/bookwerx"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// A ledger with one currency, two accounts that are both tagged with one category, and nothing posted yet.
+type ledger struct {
+	bw                     *bookwerx.Client
+	btc, cash, equity, cat uint32
+}
+
+func newLedger(t *testing.T) *ledger {
+	server := httptest.NewServer(New())
+	t.Cleanup(server.Close)
+
+	bw := bookwerx.NewClient(server.URL, "", http.DefaultClient)
+	apikey, err := bw.CreateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &ledger{bw: bookwerx.NewClient(server.URL, apikey, http.DefaultClient)}
+	must := func(id uint32, err error) uint32 {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	l.btc = must(l.bw.CreateCurrency("BTC", "Bitcoin"))
+	l.cash = must(l.bw.CreateAccount(l.btc, "Cash"))
+	l.equity = must(l.bw.CreateAccount(l.btc, "Equity"))
+	l.cat = must(l.bw.CreateCategory("X", "Everything"))
+	must(l.bw.TagAccount(l.cash, l.cat))
+	must(l.bw.TagAccount(l.equity, l.cat))
+	return l
+}
+
+// Post a transaction without checking that it balances.
+func (l *ledger) post(t *testing.T, distributions ...bookwerx.Distribution) uint32 {
+	t.Helper()
+	id, err := l.bw.PostUnchecked("test", "2021-01-01", distributions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestBalances(t *testing.T) {
+	l := newLedger(t)
+	l.post(t, bookwerx.Distribution{AccountID: l.cash, Amount: 15, AmountExp: -1}, bookwerx.Distribution{AccountID: l.equity, Amount: -15, AmountExp: -1})
+	l.post(t, bookwerx.Distribution{AccountID: l.cash, Amount: 25, AmountExp: -2}, bookwerx.Distribution{AccountID: l.equity, Amount: -25, AmountExp: -2})
+
+	sum, err := l.bw.AccountBalance(l.cash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != (bookwerx.Sum{Amount: 175, Exp: -2}) {
+		t.Errorf("the balance of Cash is %s, expected 1.75", sum)
+	}
+
+	balances, err := l.bw.CategoryBalances(l.cat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"Cash": "1.75", "Equity": "-1.75"}
+	if len(balances) != len(expected) {
+		t.Fatalf("category X has %d balances, expected %d", len(balances), len(expected))
+	}
+	for _, b := range balances {
+		if b.Sum.String() != expected[b.Account.Title] || b.Account.Currency.Symbol != "BTC" {
+			t.Errorf("the balance of %s is %s %s, expected %s BTC", b.Account.Title, b.Sum, b.Account.Currency.Symbol, expected[b.Account.Title])
+		}
+	}
+}
+
+// Like Bookwerx, the fake takes a transaction that doesn't balance, and still reports balances, so that the double_entry invariant can name it.
+func TestUnbalancedTransaction(t *testing.T) {
+	l := newLedger(t)
+	transactionID := l.post(t, bookwerx.Distribution{AccountID: l.cash, Amount: 1, AmountExp: 0})
+
+	if _, err := l.bw.CreateTransaction("next", "2021-01-02"); err != nil {
+		t.Errorf("cannot start a transaction while another one doesn't balance: %v", err)
+	}
+	sum, err := l.bw.AccountBalance(l.cash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.String() != "1" {
+		t.Errorf("the balance of Cash is %s, expected 1", sum)
+	}
+	distributions, err := l.bw.Distributions(transactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(distributions) != 1 {
+		t.Errorf("transaction %d has %d distributions, expected 1", transactionID, len(distributions))
+	}
+}
+
+func TestBalanceOverflow(t *testing.T) {
+	l := newLedger(t)
+	l.post(t, bookwerx.Distribution{AccountID: l.cash, Amount: 9223372036854775807, AmountExp: 0}, bookwerx.Distribution{AccountID: l.equity, Amount: -9223372036854775807, AmountExp: 0})
+	l.post(t, bookwerx.Distribution{AccountID: l.cash, Amount: 1, AmountExp: -1}, bookwerx.Distribution{AccountID: l.equity, Amount: -1, AmountExp: -1})
+
+	if sum, err := l.bw.AccountBalance(l.cash); err == nil {
+		t.Errorf("the balance of Cash doesn't fit an amount, but it's reported as %s", sum)
+	}
+	if _, err := l.bw.CategoryBalances(l.cat); err == nil {
+		t.Errorf("the balances of category X don't fit an amount, but they're reported")
+	}
+}
+
+func TestDeleteReferenced(t *testing.T) {
+	l := newLedger(t)
+	transactionID := l.post(t, bookwerx.Distribution{AccountID: l.cash, Amount: 1, AmountExp: 0}, bookwerx.Distribution{AccountID: l.equity, Amount: -1, AmountExp: 0})
+	apikey := l.bw.APIKey
+
+	tests := []bookwerx.Created{
+		{APIKey: apikey, Kind: "currency", ID: l.btc},            // Its accounts.
+		{APIKey: apikey, Kind: "account", ID: l.cash},            // Its distribution and acctcat.
+		{APIKey: apikey, Kind: "category", ID: l.cat},            // Its acctcats.
+		{APIKey: apikey, Kind: "transaction", ID: transactionID}, // Its distributions.
+		{APIKey: apikey, Kind: "apikey"},                         // Its books aren't empty.
+	}
+	for _, c := range tests {
+		if err := l.bw.Delete(c); err == nil {
+			t.Errorf("deleted %s %d although it's still referenced", c.Kind, c.ID)
+		}
+	}
+
+	// Leaves first, everything can be deleted.
+	n, err := l.bw.Empty()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 9 {
+		t.Errorf("deleted %d things, expected 9", n)
+	}
+	if err := l.bw.Delete(bookwerx.Created{APIKey: apikey, Kind: "apikey"}); err != nil {
+		t.Errorf("cannot delete the apikey of empty books: %v", err)
+	}
+}
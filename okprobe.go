@@ -2,28 +2,36 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
+	"github.com/bostontrader/oktest/scenario"
 )
 
 /* Give the baseURL of the okex or okcatbox server, an OKProbe command, and file names containing the server credentials for read, read-trade, and read-withdraw, run a series of tests of the given OKProbe command.
  */
-func testOKProbe(baseURL, command, queryString, read, trade, withdraw string) {
+func testOKProbe(ctx *scenario.Context, baseURL, command, queryString, read, trade, withdraw string) error {
 
-	test([]string{command, "--baseURL", baseURL, "--credentialsFile", read, "--makeErrorsCredentials", "--makeErrorsParams"})
-	test([]string{command, "--baseURL", baseURL, "--credentialsFile", read, "--makeErrorsWrongCredentialsType"})
-	test([]string{command, "--baseURL", baseURL, "--credentialsFile", trade, "--makeErrorsWrongCredentialsType"})
-	test([]string{command, "--baseURL", baseURL, "--credentialsFile", withdraw, "--makeErrorsWrongCredentialsType"})
-	test([]string{command, "--baseURL", baseURL, "--credentialsFile", read, "--queryString", queryString, "--forReal"})
-	fmt.Printf("test okprobe %s success\n", command)
+	tests := [][]string{
+		{command, "--baseURL", baseURL, "--credentialsFile", read, "--makeErrorsCredentials", "--makeErrorsParams"},
+		{command, "--baseURL", baseURL, "--credentialsFile", read, "--makeErrorsWrongCredentialsType"},
+		{command, "--baseURL", baseURL, "--credentialsFile", trade, "--makeErrorsWrongCredentialsType"},
+		{command, "--baseURL", baseURL, "--credentialsFile", withdraw, "--makeErrorsWrongCredentialsType"},
+		{command, "--baseURL", baseURL, "--credentialsFile", read, "--queryString", queryString, "--forReal"},
+	}
+	for _, args := range tests {
+		if err := test(ctx, args); err != nil {
+			return err
+		}
+	}
+	if !ctx.IsDryRun() {
+		fmt.Printf("test okprobe %s success\n", command)
+	}
+	return nil
 }
 
-func test(args []string) {
+func test(ctx *scenario.Context, args []string) error {
 
-	cmd := exec.Command("okprobe", args...)
-	out, err := cmd.Output()
+	out, err := ctx.Output("okprobe", args...)
 	if err != nil {
-		fmt.Printf("okprobe: out=%s, err=%v\nargs=%v\n", string(out), err, args)
-		os.Exit(1)
+		return fmt.Errorf("okprobe: out=%s, err=%v\nargs=%v", string(out), err, args)
 	}
+	return nil
 }
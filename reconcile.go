@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bostontrader/okconnect/compare"
+	"github.com/bostontrader/oktest/bookwerx"
+	"github.com/bostontrader/oktest/scenario"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// A Reconciliation compares the customer balances in the OKCatbox's books with the matching balances in the user's books.  This is oktest's own oracle, independent of okconnect, so that a bug in okconnect cannot hide a bug in the OKCatbox.
+//
+// Each of the Categories pairs an OKCatbox category of customer accounts, such as funding, with the user's category of the matching asset accounts.
+type Reconciliation struct {
+	Catbox     string // The OKCatbox's books.
+	User       string // The user's books.
+	Categories []struct {
+		Catbox uint32
+		User   uint32
+	}
+}
+
+func (r *Reconciliation) consumes() []string {
+	return []string{r.Catbox + ".apikey", r.User + ".apikey"}
+}
+
+// Return a Comparison for each category and currency where the books disagree, just like okconnect compare does.  Customer accounts are liabilities of the OKCatbox so their balances are negated, to be what the OKEx API would report.
+func (r *Reconciliation) discrepancies(ctx *scenario.Context) ([]compare.Comparison, error) {
+
+	catbox, err := ctx.Bookwerx(r.Catbox)
+	if err != nil {
+		return nil, err
+	}
+	user, err := ctx.Bookwerx(r.User)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := user.Categories()
+	if err != nil {
+		return nil, err
+	}
+	symbols := make(map[uint32]string)
+	for _, c := range categories {
+		symbols[c.ID] = c.Symbol
+	}
+
+	discrepancies := make([]compare.Comparison, 0)
+	for _, pair := range r.Categories {
+		okex, err := balancesByCurrency(catbox, pair.Catbox)
+		if err != nil {
+			return nil, err
+		}
+		books, err := balancesByCurrency(user, pair.User)
+		if err != nil {
+			return nil, err
+		}
+
+		currencies := make([]string, 0)
+		for currency := range okex {
+			currencies = append(currencies, currency)
+		}
+		for currency := range books {
+			if _, ok := okex[currency]; !ok {
+				currencies = append(currencies, currency)
+			}
+		}
+		sort.Strings(currencies)
+
+		for _, currency := range currencies {
+			customer := new(big.Rat).Neg(balance(okex, currency))
+			asset := balance(books, currency)
+			if customer.Cmp(asset) != 0 {
+				discrepancies = append(discrepancies, compare.Comparison{
+					Category:        symbols[pair.User],
+					Currency:        currency,
+					OKExBalance:     ratString(customer),
+					BookwerxBalance: ratString(asset),
+				})
+			}
+		}
+	}
+	return discrepancies, nil
+}
+
+// The total balance of the accounts tagged with the category, by currency.
+func balancesByCurrency(bw *bookwerx.Client, category uint32) (map[string]*big.Rat, error) {
+	balances, err := bw.CategoryBalances(category)
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]*big.Rat)
+	for _, b := range balances {
+		symbol := b.Account.Currency.Symbol
+		if totals[symbol] == nil {
+			totals[symbol] = new(big.Rat)
+		}
+		totals[symbol].Add(totals[symbol], b.Sum.Rat())
+	}
+	return totals, nil
+}
+
+func balance(totals map[string]*big.Rat, currency string) *big.Rat {
+	if b, ok := totals[currency]; ok {
+		return b
+	}
+	return new(big.Rat)
+}
+
+// Describe comparisons so that two lists of them can be compared.  The category is left out because okconnect names it its own way, and balances are normalized so that 1.5 and 1.50000000 are the same.
+func describe(comparisons []compare.Comparison) string {
+	normalize := func(s string) string {
+		if amount, exp, err := bookwerx.ParseDecimal(s); err == nil {
+			return bookwerx.FormatDecimal(amount, exp)
+		}
+		return s
+	}
+	described := make([]string, len(comparisons))
+	for i, c := range comparisons {
+		described[i] = fmt.Sprintf("%s OKEx=%s Bookwerx=%s", c.Currency, normalize(c.OKExBalance), normalize(c.BookwerxBalance))
+	}
+	sort.Strings(described)
+	return "[" + strings.Join(described, ", ") + "]"
+}
@@ -0,0 +1,237 @@
+package scenario
+
+import (
+	"fmt"
+	"github.com/bostontrader/oktest/bookwerx"
+	"github.com/bostontrader/oktest/supervisor"
+	"github.com/gojektech/heimdall/httpclient"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Context is shared by all of the steps of a scenario run.  It provides the servers and http client to use and the Vars that steps use to hand their results to later steps.
+//
+// Steps should execute programs and write files using the Context so that they can be part of a dry run.
+type Context struct {
+	HTTPClient  *httpclient.Client
+	BookwerxURL string
+	CatboxURL   string
+	Vars        *Vars
+
+	// If not empty, the State is written here after every section.
+	StateFile string
+
+	// If not empty, this is the directory for the files that steps generate, such as configurations and credentials.
+	Dir string
+
+	// If not empty, only run the steps that match these selectors, and the steps they depend on.
+	Only []string
+
+	// Everything that this run created in Bookwerx, in order, so that Teardown can delete it.
+	Created []bookwerx.Created
+
+	// In a dry run this prints what would have happened.
+	planner *planner
+
+	// The programs that were started, and their logs.
+	processes supervisor.Group
+	logs      logs
+
+	// The signal that interrupted the run, if any.
+	mu     sync.Mutex
+	signal os.Signal
+}
+
+// NewContext returns a Context for running the given scenario.  The server URLs are predefined as bookwerx.url and catbox.url.
+func NewContext(scenario *Scenario) (*Context, error) {
+
+	ctx := &Context{
+		HTTPClient:  httpclient.NewClient(httpclient.WithHTTPTimeout(timeout(scenario))),
+		BookwerxURL: scenario.BookwerxURL,
+		CatboxURL:   scenario.CatboxURL,
+		Vars:        NewVars(),
+	}
+	if err := ctx.Vars.Set("bookwerx.url", ctx.BookwerxURL); err != nil {
+		return nil, err
+	}
+	if err := ctx.Vars.Set("catbox.url", ctx.CatboxURL); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+func timeout(scenario *Scenario) time.Duration {
+	if scenario.Timeout == 0 {
+		return 60000 * time.Millisecond
+	}
+	return time.Duration(scenario.Timeout) * time.Millisecond
+}
+
+// DryRun makes this Context record every request, command, and file instead of sending, executing, or writing it.  If w is not nil they are also printed there as they happen.  Responses are made up, and values that came from earlier responses are printed as <placeholders> naming the variables they were saved as.  Steps are not verified and no state is saved.  Afterwards, the recording can be written as a script using WriteScript.
+func (ctx *Context) DryRun(w io.Writer) {
+	ctx.planner = newPlanner(ctx.Vars, w)
+	ctx.HTTPClient = httpclient.NewClient(httpclient.WithHTTPClient(ctx.planner))
+}
+
+// IsDryRun is true if nothing is really happening.
+func (ctx *Context) IsDryRun() bool {
+	return ctx.planner != nil
+}
+
+// APIKey returns the Bookwerx apikey of the named set of books, such as catbox or user.  It's found in the variable <books>.apikey.
+func (ctx *Context) APIKey(books string) (string, error) {
+	if books == "" {
+		return "", fmt.Errorf("no books specified")
+	}
+	return ctx.Vars.Get(books + ".apikey")
+}
+
+// Bookwerx returns a client for the named set of books.  Use the empty string for a client that has no apikey yet.  The titles and notes of everything that it creates are prefixed with the run ID.  Everything that it creates is added to ctx.Created, and removed again if it's rolled back.
+func (ctx *Context) Bookwerx(books string) (*bookwerx.Client, error) {
+	apikey := ""
+	if books != "" {
+		var err error
+		if apikey, err = ctx.APIKey(books); err != nil {
+			return nil, err
+		}
+	}
+	bw := bookwerx.NewClient(ctx.BookwerxURL, apikey, ctx.HTTPClient)
+	bw.Prefix = ctx.Prefix("")
+	bw.OnCreate = func(created bookwerx.Created) { ctx.Created = append(ctx.Created, created) }
+	bw.OnDelete = func(deleted bookwerx.Created) {
+		for i := len(ctx.Created) - 1; i >= 0; i-- {
+			if ctx.Created[i] == deleted {
+				ctx.Created = append(ctx.Created[:i], ctx.Created[i+1:]...)
+				return
+			}
+		}
+	}
+	return bw, nil
+}
+
+// Prefix returns s prefixed with the run ID, run.id, if there is one.  Use it for anything that runs that share a Bookwerx server or an OKCatbox must not clash on, such as titles or the OKCatbox's user IDs.
+func (ctx *Context) Prefix(s string) string {
+	if id, ok := ctx.Vars.Lookup("run.id"); ok && id != "" {
+		return id + "-" + s
+	}
+	return s
+}
+
+// SetCatboxURL changes the URL of the OKCatbox, and catbox.url, such as when the OKCatbox is given a port of its own.
+func (ctx *Context) SetCatboxURL(u string) error {
+	ctx.CatboxURL = u
+	return ctx.Vars.Update("catbox.url", u)
+}
+
+// SetID defines name as a Bookwerx ID.
+func (ctx *Context) SetID(name string, id uint32) error {
+	return ctx.Vars.Set(name, strconv.FormatUint(uint64(id), 10))
+}
+
+// Output runs the named program and returns its standard output.  Once the run is interrupted, nothing more is run.
+func (ctx *Context) Output(name string, arg ...string) ([]byte, error) {
+	if ctx.planner != nil {
+		ctx.planner.command(false, "", 0, name, arg...)
+		return []byte("[]"), nil
+	}
+	if err := ctx.interrupted(); err != nil {
+		return nil, err
+	}
+	return exec.Command(name, arg...).Output()
+}
+
+// Start starts the named program in the background and returns its PID.  Its output is appended to <name>.log in Dir, rather than mixed into ours.  If ready is not empty then Start waits until the program accepts connections at that URL, and fails if the program exits first, with what the program wrote to its standard error, or if it still isn't ready after the deadline.  The program keeps running until Stop.
+func (ctx *Context) Start(ready string, deadline time.Duration, name string, arg ...string) (string, error) {
+	if ctx.planner != nil {
+		return ctx.planner.command(true, ready, deadline, name, arg...), nil
+	}
+	var host string
+	if ready != "" {
+		u, err := url.Parse(ready)
+		if err != nil {
+			return "", fmt.Errorf("cannot parse %s: %v", ready, err)
+		}
+		host = u.Host
+	}
+	p, err := ctx.processes.Start(ctx.logFile(name), name, arg...)
+	if err != nil {
+		return "", err
+	}
+	if host != "" {
+		dial := func() error {
+			conn, err := net.DialTimeout("tcp", host, time.Second)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+		if err = p.WaitReady(dial, deadline, 100*time.Millisecond); err != nil {
+			p.Stop()
+			return "", err
+		}
+	}
+	return strconv.Itoa(p.Pid()), nil
+}
+
+// Kill kills the program with the given PID, which must have been started with Start, as abruptly as a crash, and waits for it to exit.
+func (ctx *Context) Kill(pid string) error {
+	if ctx.planner != nil {
+		ctx.planner.command(false, "", 0, "kill", "-KILL", pid)
+		return nil
+	}
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return fmt.Errorf("%s is not a PID", pid)
+	}
+	return ctx.processes.Kill(n)
+}
+
+// Stop terminates every program that was started, together with anything that they started.  It's safe to call from a signal handler, and afterwards nothing more can be started.
+func (ctx *Context) Stop() {
+	ctx.processes.Stop()
+}
+
+// Interrupt stops everything that was started, like Stop, and makes the run fail before its next step, so that what it created is still saved and can be torn down.  It's safe to call from a signal handler.
+func (ctx *Context) Interrupt(sig os.Signal) {
+	ctx.mu.Lock()
+	ctx.signal = sig
+	ctx.mu.Unlock()
+	ctx.Stop()
+}
+
+// interrupted returns an error if the run was interrupted.
+func (ctx *Context) interrupted() error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.signal == nil {
+		return nil
+	}
+	return fmt.Errorf("interrupted by %v", ctx.signal)
+}
+
+// Path returns the absolute path of the named file in Dir.  Absolute names, and every name if there is no Dir, are returned as they are.
+func (ctx *Context) Path(name string) string {
+	if ctx.Dir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(ctx.Dir, name)
+}
+
+// WriteFile writes data to the named file, in Dir.
+func (ctx *Context) WriteFile(fileName string, data []byte) error {
+	fileName = ctx.Path(fileName)
+	if ctx.planner != nil {
+		ctx.planner.writeFile(fileName, data)
+		return nil
+	}
+	return ioutil.WriteFile(fileName, data, 0600)
+}
@@ -0,0 +1,155 @@
+package scenario
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// In a dry run nothing is sent anywhere.  The planner records, and optionally prints, every request, command, and file instead and it answers with made-up responses.  Every value that it makes up is unique so that, when it shows up later, we can tell which variable it was saved as.
+type planner struct {
+	w      io.Writer // If not nil, print every event as it happens.
+	events []*event
+	issued map[string]string // Made-up value -> the jq path to find it in its response.
+	saved  map[string]string // Made-up value -> the name of the variable it was first saved as.
+	next   int
+}
+
+// Something that would have happened.
+type event struct {
+	comment string
+
+	method  string
+	url     string
+	headers []string
+	body    string
+	issued  []string // The values made up for the response.
+
+	command    []string
+	background bool
+	ready      string        // A background command is ready once this URL accepts connections...
+	deadline   time.Duration // ...which must happen within this long.
+
+	file string
+	data string
+}
+
+var plannerToken = regexp.MustCompile(`[A-Za-z0-9_-]+`)
+
+func newPlanner(vars *Vars, w io.Writer) *planner {
+	p := &planner{w: w, issued: make(map[string]string), saved: make(map[string]string), next: 9000001}
+	vars.saved = func(name, value string) {
+		if _, ok := p.issued[value]; ok && p.saved[value] == "" {
+			p.saved[value] = name
+		}
+	}
+	return p
+}
+
+// Make up a new value that can be found in its response at the given jq path.
+func (p *planner) issue(prefix, path string) string {
+	var value string
+	if prefix == "" {
+		value = strconv.Itoa(p.next)
+	} else {
+		value = fmt.Sprintf("%s-%d", prefix, p.next)
+	}
+	p.next++
+	p.issued[value] = path
+	return value
+}
+
+// Replace every made-up value in s with a <placeholder> naming the variable it was saved as.
+func (p *planner) placeholders(s string) string {
+	return plannerToken.ReplaceAllStringFunc(s, func(token string) string {
+		if name, ok := p.saved[token]; ok {
+			return "<" + name + ">"
+		}
+		return token
+	})
+}
+
+func (p *planner) comment(format string, a ...interface{}) {
+	p.events = append(p.events, &event{comment: fmt.Sprintf(format, a...)})
+}
+
+// Do records and prints the request and returns a response that can be decoded as a Bookwerx apikey, a Bookwerx LastInsertID, or OKCatbox credentials.  A GET is answered with null, so queries find nothing.
+func (p *planner) Do(req *http.Request) (*http.Response, error) {
+
+	e := &event{method: req.Method, url: req.URL.String()}
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		e.body = string(b)
+	}
+	for k, v := range req.Header {
+		e.headers = append(e.headers, fmt.Sprintf("%s: %s", k, strings.Join(v, ", ")))
+	}
+	sort.Strings(e.headers)
+	p.events = append(p.events, e)
+
+	if p.w != nil {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%s %s\n", e.method, e.url)
+		for _, h := range e.headers {
+			fmt.Fprintf(&sb, "%s\n", h)
+		}
+		if e.body != "" {
+			fmt.Fprintf(&sb, "%s\n", e.body)
+		}
+		fmt.Fprintf(p.w, "%s\n", p.placeholders(sb.String()))
+	}
+
+	response := "null"
+	if req.Method != http.MethodGet {
+		e.issued = []string{p.issue("APIKEY", ".apikey"), p.issue("", ".LastInsertId"), p.issue("KEY", ".Key"), p.issue("SECRET", ".SecretKey"), p.issue("PASSPHRASE", ".Passphrase")}
+		response = fmt.Sprintf(`{"apikey":"%s","LastInsertId":%s,"Key":"%s","SecretKey":"%s","Passphrase":"%s"}`,
+			e.issued[0], e.issued[1], e.issued[2], e.issued[3], e.issued[4])
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(response))),
+		Request:    req,
+	}, nil
+}
+
+// Record and print a command instead of executing it.  A background command gets a made-up PID and, if ready is not empty, it's waited for until it accepts connections at that URL.
+func (p *planner) command(background bool, ready string, deadline time.Duration, name string, arg ...string) string {
+	e := &event{command: append([]string{name}, arg...), background: background, ready: ready, deadline: deadline}
+	p.events = append(p.events, e)
+
+	if p.w != nil {
+		line := strings.Join(e.command, " ")
+		if background {
+			line += " &"
+		}
+		fmt.Fprintf(p.w, "$ %s\n\n", p.placeholders(line))
+	}
+
+	if !background {
+		return ""
+	}
+	pid := p.issue("", "$!")
+	e.issued = []string{pid}
+	return pid
+}
+
+// Record and print the contents of a file instead of writing it.
+func (p *planner) writeFile(fileName string, data []byte) {
+	p.events = append(p.events, &event{file: fileName, data: string(data)})
+	if p.w != nil {
+		fmt.Fprintf(p.w, "Write %s:\n%s\n\n", fileName, p.placeholders(string(data)))
+	}
+}
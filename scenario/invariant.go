@@ -0,0 +1,43 @@
+package scenario
+
+import (
+	"fmt"
+)
+
+// Run and verify every invariant that can be checked yet.  An invariant can't be checked until every variable that it refers to, or consumes, has been defined.  Nothing is checked in a dry run.
+func checkInvariants(scenario *Scenario, ctx *Context) error {
+
+	if ctx.IsDryRun() {
+		return nil
+	}
+
+	for i := range scenario.Invariants {
+		entry := &scenario.Invariants[i]
+		if !defined(ctx, entry.References()) {
+			continue
+		}
+		step, err := entry.Step(ctx.Vars)
+		if err != nil {
+			return fmt.Errorf("invariant: %v", err)
+		}
+		if consumer, ok := step.(Consumer); ok && !defined(ctx, consumer.Consumes()) {
+			continue
+		}
+		if err = step.Run(ctx); err != nil {
+			return fmt.Errorf("invariant %s: %v", step.Name(), err)
+		}
+		if err = step.Verify(ctx); err != nil {
+			return fmt.Errorf("invariant %s: %v", step.Name(), err)
+		}
+	}
+	return nil
+}
+
+func defined(ctx *Context, names []string) bool {
+	for _, name := range names {
+		if _, ok := ctx.Vars.Lookup(name); !ok {
+			return false
+		}
+	}
+	return true
+}
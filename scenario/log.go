@@ -0,0 +1,86 @@
+package scenario
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// How many of the last lines that a program logged during a section are shown when the section fails.
+const reportLines = 50
+
+// Programs that are started with Start log to <name>.log in Dir.  Where each log was when the current section began is remembered so that steps can check, and failures can show, only what was logged during the section.
+type logs struct {
+	files map[string]string // Program name -> log file.
+	marks map[string]int64  // Program name -> the size of its log when the section began.
+}
+
+// The log file of the named program.
+func (ctx *Context) logFile(name string) string {
+	if ctx.logs.files == nil {
+		ctx.logs.files = make(map[string]string)
+		ctx.logs.marks = make(map[string]int64)
+	}
+	file := ctx.Path(name + ".log")
+	if _, ok := ctx.logs.files[name]; !ok {
+		ctx.logs.files[name] = file
+		ctx.logs.marks[name] = size(file)
+	}
+	return file
+}
+
+// Remember where every log is as a section begins.
+func (ctx *Context) beginSection() {
+	for name, file := range ctx.logs.files {
+		ctx.logs.marks[name] = size(file)
+	}
+}
+
+// Log returns what the named program, which was started with Start, has logged since the current section began.
+func (ctx *Context) Log(name string) (string, error) {
+	file, ok := ctx.logs.files[name]
+	if !ok {
+		return "", fmt.Errorf("%s was never started", name)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if mark := ctx.logs.marks[name]; mark <= int64(len(b)) {
+		b = b[mark:]
+	}
+	return string(b), nil
+}
+
+// Add the end of what every program logged during the section to err.
+func (ctx *Context) withLogs(err error) error {
+	names := make([]string, 0, len(ctx.logs.files))
+	for name := range ctx.logs.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msg := err.Error()
+	for _, name := range names {
+		log, lerr := ctx.Log(name)
+		if lerr != nil || strings.TrimSpace(log) == "" {
+			continue
+		}
+		lines := strings.Split(strings.TrimRight(log, "\n"), "\n")
+		if len(lines) > reportLines {
+			lines = lines[len(lines)-reportLines:]
+		}
+		msg += fmt.Sprintf("\n\n%s logged this during the section, see %s:\n%s", name, ctx.logs.files[name], strings.Join(lines, "\n"))
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+func size(file string) int64 {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
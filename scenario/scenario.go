@@ -0,0 +1,324 @@
+// Package scenario reads declarative test scenarios and executes them.  Each entry of a scenario file is a typed Step and the steps available to a scenario are those that have been Registered.
+package scenario
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// A Scenario is the declarative description of a test run.
+type Scenario struct {
+	Name string
+
+	// This test uses two servers.
+	BookwerxURL string `yaml:"bookwerx_url"`
+	CatboxURL   string `yaml:"catbox_url"`
+
+	// The http client timeout, in milliseconds.
+	Timeout int
+
+	Sections []Section
+
+	// These are checked after every section, once every variable that they refer to has been defined.
+	Invariants []Entry
+}
+
+// A Section is a numbered group of steps, such as "2. Install, configure, and execute the OKCatbox".
+type Section struct {
+	Name    string
+	Success string // Printed after all of the steps have succeeded.
+	Steps   []Entry
+}
+
+// An Entry is a single typed entry of a Section.  The Type determines which registered Step the remaining fields are decoded into.  The other fields are common to every entry and they are used to select a subset of the scenario.
+type Entry struct {
+	Type  string
+	ID    string
+	Tags  []string
+	Needs []string // Variables that this step needs, beyond the ones it refers to.
+	node  yaml.Node
+	dir   string // The directory of the scenario file.
+}
+
+// A Reader is a Step that reads files that the scenario refers to, such as a chart of accounts.  Those are relative to the scenario file, wherever oktest runs from, so the Step is told the scenario file's directory as soon as it has been decoded.
+type Reader interface {
+	SetScenarioDir(dir string)
+}
+
+// Tell step where the scenario file is, if it wants to know.
+func (e *Entry) locate(step Step) {
+	if reader, ok := step.(Reader); ok && e.dir != "" {
+		reader.SetScenarioDir(e.dir)
+	}
+}
+
+func (e *Entry) UnmarshalYAML(value *yaml.Node) error {
+	var t struct {
+		Type  string
+		ID    string
+		Tags  []string
+		Needs []string
+	}
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	if t.Type == "" {
+		return fmt.Errorf("line %d: step has no type", value.Line)
+	}
+	e.Type, e.ID, e.Tags, e.Needs = t.Type, t.ID, t.Tags, t.Needs
+	e.node = *value
+	return nil
+}
+
+// Step returns a new Step, of the registered Type, decoded from this entry after every ${name} in it has been expanded using vars.
+func (e *Entry) Step(vars *Vars) (Step, error) {
+	step, err := New(e.Type)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", e.node.Line, err)
+	}
+	node, err := expandNode(&e.node, vars.Expand)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", e.node.Line, err)
+	}
+	if err = node.Decode(step); err != nil {
+		return nil, fmt.Errorf("line %d: cannot decode %s step: %v", e.node.Line, e.Type, err)
+	}
+	e.locate(step)
+	return step, nil
+}
+
+// References returns the names of every variable that this entry refers to, including its Needs.
+func (e *Entry) References() []string {
+	refs := append([]string{}, e.Needs...)
+	_, _ = expandNode(&e.node, func(s string) (string, error) {
+		refs = append(refs, references(s)...)
+		return s, nil
+	})
+	return refs
+}
+
+// Return a copy of node with every scalar expanded.
+func expandNode(node *yaml.Node, expand func(string) (string, error)) (*yaml.Node, error) {
+	n := *node
+	if n.Kind == yaml.ScalarNode {
+		value, err := expand(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		if value != n.Value && n.Style == 0 {
+			// Let the expanded value of a plain scalar resolve to whatever it looks like, such as an integer.
+			n.Tag = ""
+		}
+		n.Value = value
+		return &n, nil
+	}
+	n.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c, err := expandNode(child, expand)
+		if err != nil {
+			return nil, err
+		}
+		n.Content[i] = c
+	}
+	return &n, nil
+}
+
+// Load reads and parses a scenario file.  Every entry must be of a registered step type.
+func Load(fileName string) (*Scenario, error) {
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var scenario Scenario
+	if err = yaml.Unmarshal(b, &scenario); err != nil {
+		return nil, err
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(fileName))
+	if err != nil {
+		return nil, err
+	}
+	for i := range scenario.Sections {
+		section := &scenario.Sections[i]
+		for j := range section.Steps {
+			entry := &section.Steps[j]
+			if _, err = New(entry.Type); err != nil {
+				return nil, fmt.Errorf("section %s: line %d: %v", section.Name, entry.node.Line, err)
+			}
+			entry.dir = dir
+		}
+	}
+	for i := range scenario.Invariants {
+		entry := &scenario.Invariants[i]
+		if _, err = New(entry.Type); err != nil {
+			return nil, fmt.Errorf("invariants: line %d: %v", entry.node.Line, err)
+		}
+		entry.dir = dir
+	}
+
+	return &scenario, nil
+}
+
+// Run executes every step of every section, in order, and stops at the first error.  It starts a new state file, but anything that an earlier run created on the same Bookwerx server, and never tore down, is carried over so it's not forgotten.
+func Run(scenario *Scenario, ctx *Context) error {
+
+	if ctx.StateFile != "" && !ctx.IsDryRun() {
+		if previous, err := LoadState(ctx.StateFile); err == nil && len(previous.Created) > 0 {
+			if previous.BookwerxURL == ctx.BookwerxURL {
+				ctx.Created = append(previous.Created, ctx.Created...)
+				fmt.Printf("An earlier run created %d things in Bookwerx that were never torn down.  They're carried over to this run.\n\n", len(previous.Created))
+			} else {
+				fmt.Printf("An earlier run created %d things at %s that were never torn down.  They're forgotten.\n\n", len(previous.Created), previous.BookwerxURL)
+			}
+		}
+	}
+
+	state := &State{Scenario: scenario.Name}
+	if err := SaveState(ctx, state); err != nil {
+		return fmt.Errorf("cannot save the state: %v", err)
+	}
+	return run(scenario, ctx, state, 0)
+}
+
+// Resume continues a run of scenario, that was checkpointed in the given state, at the named section.  Every section before that one must have been completed.  Nothing in the earlier sections is executed again, except that their Resumers get to Resume.
+func Resume(scenario *Scenario, ctx *Context, state *State, section string) error {
+
+	if state.Scenario != scenario.Name {
+		return fmt.Errorf("the state is for scenario %s, not %s", state.Scenario, scenario.Name)
+	}
+	if state.BookwerxURL != "" && state.BookwerxURL != ctx.BookwerxURL {
+		return fmt.Errorf("the state is for the Bookwerx server at %s, not %s", state.BookwerxURL, ctx.BookwerxURL)
+	}
+
+	from := -1
+	for i, s := range scenario.Sections {
+		if s.Name == section {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return fmt.Errorf("scenario %s has no section %s", scenario.Name, section)
+	}
+
+	completed := make(map[string]bool)
+	for _, name := range state.Completed {
+		completed[name] = true
+	}
+	for _, s := range scenario.Sections[:from] {
+		if !completed[s.Name] {
+			return fmt.Errorf("cannot resume from section %s because section %s was never completed", section, s.Name)
+		}
+	}
+
+	if err := ctx.Vars.Restore(state.Vars); err != nil {
+		return err
+	}
+	if u, ok := ctx.Vars.Lookup("catbox.url"); ok {
+		ctx.CatboxURL = u // The OKCatbox may have been given a port of its own.
+	}
+	ctx.Created = state.Created
+
+	for _, s := range scenario.Sections[:from] {
+		for _, entry := range s.Steps {
+			step, err := entry.Step(ctx.Vars)
+			if err != nil {
+				return fmt.Errorf("section %s: %v", s.Name, err)
+			}
+			if resumer, ok := step.(Resumer); ok {
+				if err = resumer.Resume(ctx); err != nil {
+					return fmt.Errorf("section %s: %s: resume: %v", s.Name, step.Name(), err)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Resuming scenario %s at section %s.\n\n", scenario.Name, section)
+	state.Completed = state.Completed[:0]
+	for _, s := range scenario.Sections[:from] {
+		state.Completed = append(state.Completed, s.Name)
+	}
+	return run(scenario, ctx, state, from)
+}
+
+func run(scenario *Scenario, ctx *Context, state *State, from int) (err error) {
+
+	// Even if a section fails, remember what it created so that it can be torn down.  Show what the programs that the scenario started logged during the section.
+	defer func() {
+		if err != nil {
+			if err := saveCreated(ctx, scenario.Name); err != nil {
+				fmt.Printf("Cannot save the state: err=%v\n", err)
+			}
+			err = ctx.withLogs(err)
+		}
+	}()
+
+	selected, err := selectEntries(scenario, ctx, from)
+	if err != nil {
+		return err
+	}
+
+	for i := range scenario.Sections[from:] {
+		section := &scenario.Sections[from+i]
+		ctx.beginSection()
+		if ctx.planner != nil {
+			ctx.planner.comment("Section %s", section.Name)
+		}
+		ran := 0
+		for j := range section.Steps {
+			entry := &section.Steps[j]
+			if selected != nil && !selected[entry] {
+				continue
+			}
+			if err = ctx.interrupted(); err != nil {
+				return fmt.Errorf("section %s: %v", section.Name, err)
+			}
+			step, err := entry.Step(ctx.Vars)
+			if err != nil {
+				return fmt.Errorf("section %s: %v", section.Name, err)
+			}
+			if ctx.planner != nil {
+				ctx.planner.comment("%s", step.Name())
+			}
+			if err = step.Run(ctx); err != nil {
+				if ierr := ctx.interrupted(); ierr != nil {
+					err = ierr // The step most likely failed because the programs it needed were stopped.
+				}
+				return fmt.Errorf("section %s: %s: %v", section.Name, step.Name(), err)
+			}
+			if ctx.IsDryRun() {
+				ran++
+				continue
+			}
+			if err = step.Verify(ctx); err != nil {
+				return fmt.Errorf("section %s: %s: verify: %v", section.Name, step.Name(), err)
+			}
+			ran++
+		}
+
+		// Only a section whose every step was run counts as completed.
+		if ran == 0 && len(section.Steps) > 0 {
+			continue
+		}
+		if err := checkInvariants(scenario, ctx); err != nil {
+			return fmt.Errorf("section %s: %v", section.Name, err)
+		}
+		if ran == len(section.Steps) {
+			state.Completed = append(state.Completed, section.Name)
+		}
+		if err := SaveState(ctx, state); err != nil {
+			return fmt.Errorf("section %s: cannot save the state: %v", section.Name, err)
+		}
+		if ran < len(section.Steps) {
+			fmt.Printf("Section %s partial success.  I ran %d of its %d steps.\n\n", section.Name, ran, len(section.Steps))
+		} else {
+			fmt.Printf("Section %s success.  %s\n\n", section.Name, section.Success)
+		}
+	}
+
+	return nil
+}
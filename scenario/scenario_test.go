@@ -0,0 +1,56 @@
+package scenario
+
+import (
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"testing"
+)
+
+// A step that counts how often it's run and, if Interrupt, interrupts the run the way a signal handler would.
+type interruptTestStep struct {
+	Interrupt bool
+}
+
+var interruptTestRuns int
+
+func (s *interruptTestStep) Name() string { return "interrupt_test" }
+func (s *interruptTestStep) Run(ctx *Context) error {
+	interruptTestRuns++
+	if s.Interrupt {
+		ctx.Interrupt(os.Interrupt)
+	}
+	return nil
+}
+func (s *interruptTestStep) Verify(ctx *Context) error { return nil }
+
+func init() {
+	Register("interrupt_test", func() Step { return &interruptTestStep{} })
+}
+
+func TestInterrupt(t *testing.T) {
+	var scenario Scenario
+	err := yaml.Unmarshal([]byte(`
+name: interrupt
+sections:
+  - name: "1"
+    steps:
+      - {type: interrupt_test, interrupt: true}
+      - {type: interrupt_test}
+`), &scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := NewContext(&scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interruptTestRuns = 0
+	err = Run(&scenario, ctx)
+	if err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Errorf("expected the run to fail because it was interrupted, got %v", err)
+	}
+	if interruptTestRuns != 1 {
+		t.Errorf("%d steps were run, expected only the one that interrupted the run", interruptTestRuns)
+	}
+}
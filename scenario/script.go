@@ -0,0 +1,151 @@
+package scenario
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var shellUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Turn a variable name such as catbox.currency.BTC into a shell variable name such as CATBOX_CURRENCY_BTC.
+func shellName(name string) string {
+	return strings.ToUpper(shellUnsafe.ReplaceAllString(name, "_"))
+}
+
+// Escape s for use inside double quotes, or an unquoted here-document, in bash.
+func shellEscape(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "$", `\$`)
+	s = strings.ReplaceAll(s, "`", "\\`")
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+// WriteScript writes everything that happened during a dry run as an equivalent bash script that uses curl and jq.  Values that come from a response are captured in shell variables, named after the scenario variables they were saved as, and later requests, commands, and files use those shell variables.
+func (ctx *Context) WriteScript(w io.Writer, scenario *Scenario) error {
+
+	p := ctx.planner
+	if p == nil {
+		return fmt.Errorf("a script can only be written after a dry run")
+	}
+
+	// Every made-up value that shows up again later needs a shell variable.
+	used := make(map[string]bool)
+	for _, e := range p.events {
+		for _, s := range append(append([]string{e.url, e.body, e.data}, e.command...), e.headers...) {
+			for _, token := range plannerToken.FindAllString(s, -1) {
+				if _, ok := p.issued[token]; ok {
+					used[token] = true
+				}
+			}
+		}
+	}
+	// Name them in the order they were issued, after the variables they were first saved as.  A variable that's saved again, such as the PID of a restarted process, gets a numbered shell variable each time, such as CATBOX_PID and then CATBOX_PID_2.
+	shellNames := make(map[string]string)
+	taken := make(map[string]int)
+	unnamed := 0
+	for _, e := range p.events {
+		for _, value := range e.issued {
+			name := shellName(p.saved[value])
+			switch {
+			case p.saved[value] != "":
+				used[value] = true
+				if taken[name]++; taken[name] > 1 {
+					name = fmt.Sprintf("%s_%d", name, taken[name])
+				}
+			case used[value]:
+				unnamed++
+				name = fmt.Sprintf("%s_%d", shellName(strings.TrimPrefix(p.issued[value], ".")), unnamed)
+			default:
+				continue
+			}
+			shellNames[value] = name
+		}
+	}
+
+	// Rewrite s for the script.
+	urls := [][2]string{{ctx.BookwerxURL, "${BOOKWERX_URL}"}, {ctx.CatboxURL, "${CATBOX_URL}"}}
+	rewrite := func(s string, quote bool) string {
+		s = shellEscape(s, quote)
+		for _, u := range urls {
+			if u[0] != "" {
+				s = strings.ReplaceAll(s, shellEscape(u[0], quote), u[1])
+			}
+		}
+		return plannerToken.ReplaceAllStringFunc(s, func(token string) string {
+			if name, ok := shellNames[token]; ok {
+				return "${" + name + "}"
+			}
+			return token
+		})
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#!/bin/bash\n")
+	fmt.Fprintf(&sb, "# This script was exported by oktest from scenario %s.  It replays every request and command that oktest makes.\n", scenario.Name)
+	fmt.Fprintf(&sb, "set -eo pipefail\n\n")
+	fmt.Fprintf(&sb, "BOOKWERX_URL=\"%s\"\n", shellEscape(ctx.BookwerxURL, true))
+	fmt.Fprintf(&sb, "CATBOX_URL=\"%s\"\n", shellEscape(ctx.CatboxURL, true))
+
+	for _, e := range p.events {
+		switch {
+		case e.comment != "":
+			fmt.Fprintf(&sb, "\n# %s\n", p.placeholders(e.comment))
+
+		case e.method != "":
+			curl := fmt.Sprintf("curl -sf -X %s", e.method)
+			for _, h := range e.headers {
+				curl += fmt.Sprintf(" -H \"%s\"", rewrite(h, true))
+			}
+			if e.body != "" {
+				curl += fmt.Sprintf(" --data-raw \"%s\"", rewrite(e.body, true))
+			}
+			curl += fmt.Sprintf(" \"%s\"", rewrite(e.url, true))
+
+			var captures []string
+			for _, value := range e.issued {
+				if used[value] {
+					captures = append(captures, value)
+				}
+			}
+			switch len(captures) {
+			case 0:
+				fmt.Fprintf(&sb, "%s\n", curl)
+			case 1:
+				fmt.Fprintf(&sb, "%s=\"$(%s | jq -r %s)\"\n", shellNames[captures[0]], curl, p.issued[captures[0]])
+			default:
+				fmt.Fprintf(&sb, "RESPONSE=\"$(%s)\"\n", curl)
+				for _, value := range captures {
+					fmt.Fprintf(&sb, "%s=\"$(echo \"$RESPONSE\" | jq -r %s)\"\n", shellNames[value], p.issued[value])
+				}
+			}
+
+		case len(e.command) > 0:
+			args := make([]string, len(e.command))
+			for i, arg := range e.command {
+				args[i] = fmt.Sprintf("\"%s\"", rewrite(arg, true))
+			}
+			if e.background {
+				fmt.Fprintf(&sb, "%s &\n", strings.Join(args, " "))
+				if len(e.issued) > 0 && used[e.issued[0]] {
+					fmt.Fprintf(&sb, "%s=$!\n", shellNames[e.issued[0]])
+				}
+				if e.ready != "" {
+					fmt.Fprintf(&sb, "timeout %g bash -c 'until curl -s \"$0\" >/dev/null; do sleep 0.1; done' \"%s\"\n", e.deadline.Seconds(), rewrite(e.ready, true))
+				}
+			} else {
+				fmt.Fprintf(&sb, "%s\n", strings.Join(args, " "))
+			}
+
+		case e.file != "":
+			fmt.Fprintf(&sb, "cat > \"%s\" <<EOF\n%s\nEOF\n", rewrite(e.file, true), strings.TrimRight(rewrite(e.data, false), "\n"))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,123 @@
+package scenario
+
+import (
+	"fmt"
+)
+
+// A Producer is a Step that defines variables.  Producers are how we figure out which steps a selected step depends on.
+type Producer interface {
+
+	// Produces returns the names of the variables that Run will define.
+	Produces() []string
+}
+
+// A Consumer is a Step that uses variables other than the ones its entry refers to as ${name}, such as the apikey of the books that it works on.
+type Consumer interface {
+
+	// Consumes returns the names of the variables that Run will use.
+	Consumes() []string
+}
+
+// Decode this entry with every ${name} removed.  It's enough to learn what a step Produces without having run the steps before it.
+func (e *Entry) plan() (Step, error) {
+	step, err := New(e.Type)
+	if err != nil {
+		return nil, err
+	}
+	node, _ := expandNode(&e.node, func(s string) (string, error) {
+		return varTemplate.ReplaceAllString(s, ""), nil
+	})
+	if err = node.Decode(step); err != nil {
+		return nil, fmt.Errorf("line %d: cannot decode %s step: %v", e.node.Line, e.Type, err)
+	}
+	e.locate(step)
+	return step, nil
+}
+
+// Does the selector match this entry?
+func (e *Entry) matches(selector string) bool {
+	if e.ID != "" && e.ID == selector {
+		return true
+	}
+	for _, tag := range e.Tags {
+		if tag == selector {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the entries, of the sections starting at from, that match any of the selectors in ctx.Only plus every step that they depend on.  A selector matches every step of a section by the section's name, or a single step by its ID or by one of its tags.  A step depends on the steps that produce the variables it refers to, unless they are already defined.  A nil result means everything is selected.
+func selectEntries(scenario *Scenario, ctx *Context, from int) (map[*Entry]bool, error) {
+
+	if len(ctx.Only) == 0 {
+		return nil, nil
+	}
+
+	type candidate struct {
+		entry    *Entry
+		produces []string
+		consumes []string
+	}
+	var candidates []candidate
+	selected := make(map[*Entry]bool)
+	var pending []int
+
+	for i := from; i < len(scenario.Sections); i++ {
+		section := &scenario.Sections[i]
+		for j := range section.Steps {
+			entry := &section.Steps[j]
+			step, err := entry.plan()
+			if err != nil {
+				return nil, fmt.Errorf("section %s: %v", section.Name, err)
+			}
+			c := candidate{entry: entry}
+			if producer, ok := step.(Producer); ok {
+				c.produces = producer.Produces()
+			}
+			if consumer, ok := step.(Consumer); ok {
+				c.consumes = consumer.Consumes()
+			}
+
+			for _, selector := range ctx.Only {
+				if section.Name == selector || entry.matches(selector) {
+					selected[entry] = true
+					pending = append(pending, len(candidates))
+					break
+				}
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("nothing in scenario %s matches %v", scenario.Name, ctx.Only)
+	}
+
+	// Chase the dependencies.  Each variable is produced by the closest step before the one that needs it.
+	for len(pending) > 0 {
+		i := pending[0]
+		pending = pending[1:]
+
+	refs:
+		for _, ref := range append(candidates[i].entry.References(), candidates[i].consumes...) {
+			if _, ok := ctx.Vars.Lookup(ref); ok {
+				continue
+			}
+			for j := i - 1; j >= 0; j-- {
+				for _, name := range candidates[j].produces {
+					if name == ref {
+						if !selected[candidates[j].entry] {
+							selected[candidates[j].entry] = true
+							pending = append(pending, j)
+						}
+						continue refs
+					}
+				}
+			}
+			return nil, fmt.Errorf("line %d: no earlier step defines %s", candidates[i].entry.node.Line, ref)
+		}
+	}
+
+	return selected, nil
+}
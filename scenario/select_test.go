@@ -0,0 +1,107 @@
+package scenario
+
+import (
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// A step that defines the variables in Save and uses those in Uses, besides any that it refers to as ${name}.
+type selectTestStep struct {
+	Save  []string
+	Uses  []string
+	Value string
+}
+
+func (s *selectTestStep) Name() string              { return "select_test" }
+func (s *selectTestStep) Run(ctx *Context) error    { return nil }
+func (s *selectTestStep) Verify(ctx *Context) error { return nil }
+func (s *selectTestStep) Produces() []string        { return s.Save }
+func (s *selectTestStep) Consumes() []string        { return s.Uses }
+
+func init() {
+	Register("select_test", func() Step { return &selectTestStep{} })
+}
+
+const selectTestScenario = `
+name: select
+sections:
+  - name: "1"
+    steps:
+      - {type: select_test, id: apikey, save: [user.apikey]}
+      - {type: select_test, id: unrelated, save: [catbox.apikey]}
+      - {type: select_test, id: currency, save: [user.currency.BTC], uses: [user.apikey]}
+  - name: "2"
+    steps:
+      - {type: select_test, id: account, save: [user.account.Cash], value: "${user.currency.BTC}"}
+      - {type: select_test, id: balance, tags: [assert], value: "${user.account.Cash}"}
+      - {type: select_test, id: pid, needs: [catbox.pid]}
+`
+
+// Return the IDs of the selected entries, sorted.
+func selectedIDs(t *testing.T, only []string, defined ...string) (string, error) {
+	var scenario Scenario
+	if err := yaml.Unmarshal([]byte(selectTestScenario), &scenario); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &Context{Vars: NewVars(), Only: only}
+	for _, name := range defined {
+		if err := ctx.Vars.Set(name, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	selected, err := selectEntries(&scenario, ctx, 0)
+	if err != nil {
+		return "", err
+	}
+	var ids []string
+	for entry := range selected {
+		ids = append(ids, entry.ID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ","), nil
+}
+
+func TestSelectEntries(t *testing.T) {
+	tests := []struct {
+		only    []string
+		defined []string
+		ids     string
+	}{
+		// A tag pulls in the chain of steps that it depends on, through ${name} references and Consumes, but nothing else.
+		{[]string{"assert"}, nil, "account,apikey,balance,currency"},
+		{[]string{"account"}, nil, "account,apikey,currency"},
+		{[]string{"1"}, nil, "apikey,currency,unrelated"},
+		// A variable that's already defined, such as after a resume, needs no step.
+		{[]string{"assert"}, []string{"user.currency.BTC"}, "account,balance"},
+		{[]string{"pid"}, []string{"catbox.pid"}, "pid"},
+	}
+	for _, tt := range tests {
+		ids, err := selectedIDs(t, tt.only, tt.defined...)
+		if err != nil {
+			t.Errorf("%v: %v", tt.only, err)
+			continue
+		}
+		if ids != tt.ids {
+			t.Errorf("%v selected %s, expected %s", tt.only, ids, tt.ids)
+		}
+	}
+}
+
+func TestSelectEntriesErrors(t *testing.T) {
+	// Needs names a variable that no earlier step defines.
+	if _, err := selectedIDs(t, []string{"pid"}); err == nil {
+		t.Errorf("pid should fail without catbox.pid")
+	}
+	if _, err := selectedIDs(t, []string{"nothing"}); err == nil {
+		t.Errorf("a selector that matches nothing should fail")
+	}
+}
+
+func TestSelectEverything(t *testing.T) {
+	selected, err := selectEntries(&Scenario{}, &Context{Vars: NewVars()}, 0)
+	if err != nil || selected != nil {
+		t.Errorf("without Only everything should be selected, got %v, %v", selected, err)
+	}
+}
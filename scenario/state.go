@@ -0,0 +1,72 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bostontrader/oktest/bookwerx"
+	"io/ioutil"
+	"os"
+)
+
+// State is the checkpoint of a scenario run that is written after every section.  It has everything that's needed to resume the run at a later section: apikeys, IDs, file names, the catbox's PID, etc., are all in the Vars.  It also lists everything that the run created in Bookwerx so that it can be torn down later.
+type State struct {
+	Scenario  string
+	Completed []string // The names of the completed sections, in order.
+	Vars      map[string]string
+
+	// Where, and what, the run created in Bookwerx.
+	BookwerxURL string
+	Created     []bookwerx.Created
+}
+
+// A Resumer is a Step whose effect does not outlive oktest itself, such as starting a process.  When a run is resumed, the Resumers in the skipped sections get a chance to reestablish their effect.
+type Resumer interface {
+	Resume(ctx *Context) error
+}
+
+// SaveState writes the checkpoint to ctx.StateFile, if there is one, unless this is a dry run.
+func SaveState(ctx *Context, state *State) error {
+	if ctx.StateFile == "" || ctx.IsDryRun() {
+		return nil
+	}
+	state.Vars = ctx.Vars.Snapshot()
+	return writeState(ctx, state)
+}
+
+// saveCreated updates the list of created things in ctx.StateFile, if there is one, but leaves the rest of the checkpoint alone.  Use this when a section fails so that what it did create can still be torn down.
+func saveCreated(ctx *Context, scenario string) error {
+	if ctx.StateFile == "" || ctx.IsDryRun() {
+		return nil
+	}
+	state, err := LoadState(ctx.StateFile)
+	if os.IsNotExist(err) {
+		state, err = &State{Scenario: scenario}, nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeState(ctx, state)
+}
+
+func writeState(ctx *Context, state *State) error {
+	state.BookwerxURL = ctx.BookwerxURL
+	state.Created = ctx.Created
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ctx.StateFile, b, 0600)
+}
+
+// LoadState reads a checkpoint.
+func LoadState(fileName string) (*State, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("cannot decode state file %s: %v", fileName, err)
+	}
+	return &state, nil
+}
@@ -0,0 +1,54 @@
+package scenario
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Step is a single action of a scenario, such as creating a Bookwerx account or running okconnect compare.  A Step is decoded from its entry in the scenario file, then Run, then Verified.  Any error fails the scenario.
+type Step interface {
+
+	// Name briefly describes this particular step, for progress and error messages.
+	Name() string
+
+	// Run performs the action.
+	Run(ctx *Context) error
+
+	// Verify checks that Run did what it was supposed to do.
+	Verify(ctx *Context) error
+}
+
+// A Factory returns a new, empty, Step that the fields of a scenario entry can be decoded into.
+type Factory func() Step
+
+var registry = make(map[string]Factory)
+
+// Register makes a Step available to scenario files under the given type name.  It's intended to be called from the init function of the package that implements the Step so that the okcatbox, okconnect, and okprobe repositories can contribute their own steps.  Registering the same type name twice panics.
+func Register(typeName string, factory Factory) {
+	if factory == nil {
+		panic("scenario: Register factory is nil")
+	}
+	if _, dup := registry[typeName]; dup {
+		panic("scenario: Register called twice for step type " + typeName)
+	}
+	registry[typeName] = factory
+}
+
+// New returns a new, empty, Step of the given type.
+func New(typeName string) (Step, error) {
+	factory, ok := registry[typeName]
+	if !ok {
+		return nil, fmt.Errorf("unknown step type %s", typeName)
+	}
+	return factory(), nil
+}
+
+// Types returns the names of all registered step types, sorted.
+func Types() []string {
+	types := make([]string, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
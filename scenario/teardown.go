@@ -0,0 +1,110 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bostontrader/oktest/bookwerx"
+	"sort"
+	"strings"
+)
+
+// The order in which to delete things so that nothing is deleted while something else still refers to it.
+var teardownOrder = map[string]int{
+	"distribution": 0,
+	"transaction":  1,
+	"acctcat":      2,
+	"account":      3,
+	"category":     4,
+	"currency":     5,
+	"apikey":       6,
+}
+
+// Teardown deletes what this run put into Bookwerx.  The books of an apikey that the run created itself are emptied completely, leaves first, by asking Bookwerx what is in them, because the OKCatbox writes to them too.  Then the apikey is deleted, if Bookwerx supports that.  In books that the run only borrowed, such as those of -apikey, just the things in ctx.Created are deleted, in reverse dependency order and otherwise most recent first.  Teardown keeps going past failures, and afterwards ctx.Created, and the state file, only list what could not be deleted so that Teardown can be tried again.
+func Teardown(ctx *Context) error {
+
+	owned := make(map[string]bool)
+	var apikeys []string
+	for _, c := range ctx.Created {
+		if c.Kind == "apikey" && !owned[c.APIKey] {
+			owned[c.APIKey] = true
+			apikeys = append(apikeys, c.APIKey)
+		}
+	}
+
+	created := make([]int, 0, len(ctx.Created))
+	for i := len(ctx.Created) - 1; i >= 0; i-- {
+		if !owned[ctx.Created[i].APIKey] {
+			created = append(created, i)
+		}
+	}
+	sort.SliceStable(created, func(i, j int) bool {
+		return teardownOrder[ctx.Created[created[i]].Kind] < teardownOrder[ctx.Created[created[j]].Kind]
+	})
+
+	bw, err := ctx.Bookwerx("")
+	if err != nil {
+		return err
+	}
+	var failures []string
+	count := 0
+	deleted := make(map[int]bool)
+	for _, i := range created {
+		c := ctx.Created[i]
+		if err := bw.Delete(c); err != nil {
+			what := c.Kind + " " + c.APIKey
+			if c.ID != 0 {
+				what = fmt.Sprintf("%s %d", c.Kind, c.ID)
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", what, err))
+			continue
+		}
+		deleted[i] = true
+		count++
+	}
+
+	// emptied is true for the apikeys whose books are now empty, and gone for those that are deleted too.
+	emptied := make(map[string]bool)
+	gone := make(map[string]bool)
+	for _, apikey := range apikeys {
+		n, err := bookwerx.NewClient(ctx.BookwerxURL, apikey, ctx.HTTPClient).Empty()
+		count += n
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("the books of apikey %s: %v", apikey, err))
+			continue
+		}
+		emptied[apikey] = true
+
+		// Deleting an apikey isn't part of every Bookwerx.  If it can't be done then the apikey, with its empty books, is left behind and that is not a failure.
+		err = bw.Delete(bookwerx.Created{APIKey: apikey, Kind: "apikey"})
+		switch {
+		case errors.Is(err, bookwerx.ErrUnsupported):
+			fmt.Printf("This Bookwerx cannot delete apikeys, so apikey %s is left, with empty books.\n", apikey)
+			gone[apikey] = true
+		case err != nil:
+			failures = append(failures, fmt.Sprintf("apikey %s: %v", apikey, err))
+		default:
+			gone[apikey] = true
+			count++
+		}
+	}
+
+	remaining := ctx.Created[:0]
+	for i, c := range ctx.Created {
+		switch {
+		case deleted[i], gone[c.APIKey]:
+		case emptied[c.APIKey] && c.Kind != "apikey":
+		default:
+			remaining = append(remaining, c)
+		}
+	}
+	fmt.Printf("Teardown deleted %d things from Bookwerx.\n", count)
+	ctx.Created = remaining
+	if err := saveCreated(ctx, ""); err != nil {
+		return fmt.Errorf("cannot save the state: %v", err)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("teardown could not delete %d things:\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+	return nil
+}
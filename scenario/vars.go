@@ -0,0 +1,131 @@
+package scenario
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Vars is the store of named values that steps use to hand results to later steps.  Names are scoped with dots, such as catbox.currency.BTC or user.category.F.  A name may only be defined once.  Redefining it, or defining a name that would hide, or be hidden by, an enclosing scope, is an error.
+//
+// Values are referred to in the fields of a scenario entry as ${name}.
+type Vars struct {
+	values map[string]string
+	saved  func(name, value string) // If not nil, this is told about every value as it's set or updated.
+}
+
+var (
+	varName     = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+	varTemplate = regexp.MustCompile(`\$\{([^}]*)\}`)
+)
+
+func NewVars() *Vars {
+	return &Vars{values: make(map[string]string)}
+}
+
+// Set defines name.
+func (v *Vars) Set(name, value string) error {
+	if !varName.MatchString(name) {
+		return fmt.Errorf("%q is not a valid variable name", name)
+	}
+	if _, ok := v.values[name]; ok {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	for other := range v.values {
+		if strings.HasPrefix(other, name+".") {
+			return fmt.Errorf("%s would shadow %s", name, other)
+		}
+		if strings.HasPrefix(name, other+".") {
+			return fmt.Errorf("%s would be shadowed by %s", name, other)
+		}
+	}
+	v.values[name] = value
+	if v.saved != nil {
+		v.saved(name, value)
+	}
+	return nil
+}
+
+// Update changes the value of name, which must already be defined.  Unlike Set, this is for the rare value that legitimately changes during a run, such as the PID of a restarted process.
+func (v *Vars) Update(name, value string) error {
+	if _, ok := v.values[name]; !ok {
+		return fmt.Errorf("%s is not defined", name)
+	}
+	v.values[name] = value
+	if v.saved != nil {
+		v.saved(name, value)
+	}
+	return nil
+}
+
+// Get returns the value of name.
+func (v *Vars) Get(name string) (string, error) {
+	value, ok := v.values[name]
+	if !ok {
+		return "", fmt.Errorf("%s is not defined", name)
+	}
+	return value, nil
+}
+
+// Lookup returns the value of name, if it's defined.
+func (v *Vars) Lookup(name string) (string, bool) {
+	value, ok := v.values[name]
+	return value, ok
+}
+
+// Expand replaces every ${name} in s with its value.
+func (v *Vars) Expand(s string) (string, error) {
+	var err error
+	expanded := varTemplate.ReplaceAllStringFunc(s, func(match string) string {
+		name := varTemplate.FindStringSubmatch(match)[1]
+		value, e := v.Get(name)
+		if e != nil && err == nil {
+			err = e
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// Return the names referred to in s.
+func references(s string) []string {
+	var names []string
+	for _, match := range varTemplate.FindAllStringSubmatch(s, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// Snapshot returns a copy of every definition.
+func (v *Vars) Snapshot() map[string]string {
+	values := make(map[string]string, len(v.values))
+	for name, value := range v.values {
+		values[name] = value
+	}
+	return values
+}
+
+// Restore defines, or updates, every name in values.
+func (v *Vars) Restore(values map[string]string) error {
+	for name, value := range values {
+		if _, ok := v.values[name]; ok {
+			v.values[name] = value
+			continue
+		}
+		if err := v.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Names returns every defined name, sorted.
+func (v *Vars) Names() []string {
+	names := make([]string, 0, len(v.values))
+	for name := range v.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,95 @@
+package scenario
+
+import "testing"
+
+func TestVarsSet(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"user.category.F", true},
+		{"user.category.F", false}, // Already defined.
+		{"user.category", false},   // Would shadow user.category.F.
+		{"user.category.F.x", false},
+		{"user.category.A", true},
+		{"user..x", false},
+		{"user.x y", false},
+		{"", false},
+	}
+	v := NewVars()
+	for _, tt := range tests {
+		err := v.Set(tt.name, "1")
+		if tt.ok && err != nil {
+			t.Errorf("Set(%q): %v", tt.name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("Set(%q) should have failed", tt.name)
+		}
+	}
+}
+
+func TestVarsUpdate(t *testing.T) {
+	v := NewVars()
+	if err := v.Update("catbox.pid", "1"); err == nil {
+		t.Errorf("Update of an undefined name should have failed")
+	}
+	if err := v.Set("catbox.pid", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Update("catbox.pid", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := v.Get("catbox.pid"); value != "2" {
+		t.Errorf("catbox.pid = %q, expected 2", value)
+	}
+}
+
+func TestVarsRestore(t *testing.T) {
+	v := NewVars()
+	if err := v.Set("run.dir", "/old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Restore(map[string]string{"run.dir": "/new", "user.apikey": "K"}); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := v.Get("run.dir"); value != "/new" {
+		t.Errorf("run.dir = %q, expected /new", value)
+	}
+	if value, _ := v.Get("user.apikey"); value != "K" {
+		t.Errorf("user.apikey = %q, expected K", value)
+	}
+	if err := v.Restore(map[string]string{"user.apikey.x": "K"}); err == nil {
+		t.Errorf("Restore of a shadowing name should have failed")
+	}
+}
+
+func TestVarsExpand(t *testing.T) {
+	v := NewVars()
+	if err := v.Set("user.deposit.BTC", "1.5"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		s        string
+		expanded string
+		ok       bool
+	}{
+		{"-${user.deposit.BTC}", "-1.5", true},
+		{"${user.deposit.BTC}/${user.deposit.BTC}", "1.5/1.5", true},
+		{"no variables", "no variables", true},
+		{"${user.deposit.LTC}", "", false},
+		{"${user.deposit}", "", false},
+		{"${}", "", false},
+	}
+	for _, tt := range tests {
+		expanded, err := v.Expand(tt.s)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("Expand(%q) = %q, expected an error", tt.s, expanded)
+			}
+			continue
+		}
+		if err != nil || expanded != tt.expanded {
+			t.Errorf("Expand(%q) = %q, %v, expected %q", tt.s, expanded, err, tt.expanded)
+		}
+	}
+}
@@ -0,0 +1,825 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	utils "github.com/bostontrader/okcommon"
+	"github.com/bostontrader/okconnect/compare"
+	"github.com/bostontrader/okconnect/config"
+	"github.com/bostontrader/oktest/bookwerx"
+	"github.com/bostontrader/oktest/scenario"
+	"gopkg.in/yaml.v3"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the steps that oktest itself knows how to perform.
+func init() {
+	scenario.Register("apikey", func() scenario.Step { return &APIKeyStep{} })
+	scenario.Register("currency", func() scenario.Step { return &CurrencyStep{} })
+	scenario.Register("account", func() scenario.Step { return &AccountStep{} })
+	scenario.Register("category", func() scenario.Step { return &CategoryStep{} })
+	scenario.Register("acctcat", func() scenario.Step { return &AcctcatStep{} })
+	scenario.Register("chart", func() scenario.Step { return &ChartStep{} })
+	scenario.Register("post", func() scenario.Step { return &PostStep{} })
+	scenario.Register("catbox_config", func() scenario.Step { return &CatboxConfigStep{} })
+	scenario.Register("catbox_start", func() scenario.Step { return &CatboxStartStep{} })
+	scenario.Register("catbox_restart", func() scenario.Step { return &CatboxRestartStep{} })
+	scenario.Register("catbox_credentials", func() scenario.Step { return &CatboxCredentialsStep{} })
+	scenario.Register("okconnect_config", func() scenario.Step { return &OKConnectConfigStep{} })
+	scenario.Register("transaction", func() scenario.Step { return &TransactionStep{} })
+	scenario.Register("deposit", func() scenario.Step { return &DepositStep{} })
+	scenario.Register("okconnect_compare", func() scenario.Step { return &OKConnectCompareStep{} })
+	scenario.Register("okprobe", func() scenario.Step { return &OKProbeStep{} })
+	scenario.Register("assert_balance", func() scenario.Step { return &AssertBalanceStep{} })
+	scenario.Register("assert_transaction", func() scenario.Step { return &AssertTransactionStep{} })
+	scenario.Register("accounting_equation", func() scenario.Step { return &AccountingEquationStep{} })
+	scenario.Register("double_entry", func() scenario.Step { return &DoubleEntryStep{} })
+	scenario.Register("solvency", func() scenario.Step { return &SolvencyStep{} })
+	scenario.Register("assert_log", func() scenario.Step { return &AssertLogStep{} })
+}
+
+// Create a new Bookwerx apikey for the named set of books, such as catbox or user.  It's saved as <books>.apikey.  If <books>.apikey is already defined, such as by the -apikey flag, those existing books are used instead.
+type APIKeyStep struct {
+	Books string
+
+	apikey string
+}
+
+func (s *APIKeyStep) Name() string { return fmt.Sprintf("apikey %s", s.Books) }
+
+func (s *APIKeyStep) Produces() []string { return []string{s.Books + ".apikey"} }
+
+func (s *APIKeyStep) Run(ctx *scenario.Context) error {
+	if apikey, ok := ctx.Vars.Lookup(s.Books + ".apikey"); ok {
+		s.apikey = apikey
+		fmt.Printf("Reusing %s.apikey=%s\n", s.Books, s.apikey)
+		return nil
+	}
+	bw, err := ctx.Bookwerx("")
+	if err != nil {
+		return err
+	}
+	if s.apikey, err = bw.CreateAPIKey(); err != nil {
+		return err
+	}
+	if !ctx.IsDryRun() {
+		fmt.Printf("%s.apikey=%s\n", s.Books, s.apikey) // A dry run's apikey is made up.
+	}
+	return ctx.Vars.Set(s.Books+".apikey", s.apikey)
+}
+
+func (s *APIKeyStep) Verify(ctx *scenario.Context) error {
+	if s.apikey == "" {
+		return fmt.Errorf("Bookwerx returned an empty apikey")
+	}
+	return nil
+}
+
+// Create a currency for the named set of books, unless one with the same symbol already exists.  Its ID is saved as <books>.currency.<symbol> unless Save says otherwise.
+type CurrencyStep struct {
+	Books  string
+	Symbol string
+	Title  string
+	Save   string
+
+	id      uint32
+	created bool
+}
+
+func (s *CurrencyStep) Name() string { return fmt.Sprintf("currency %s %s", s.Books, s.Symbol) }
+
+func (s *CurrencyStep) Produces() []string {
+	return []string{saveAs(s.Save, s.Books, "currency", s.Symbol)}
+}
+
+func (s *CurrencyStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *CurrencyStep) Run(ctx *scenario.Context) error {
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+	if s.id, s.created, err = bw.EnsureCurrency(s.Symbol, s.Title); err != nil {
+		return err
+	}
+	reuse(s, s.id, s.created)
+	return ctx.SetID(saveAs(s.Save, s.Books, "currency", s.Symbol), s.id)
+}
+
+func (s *CurrencyStep) Verify(ctx *scenario.Context) error { return verifyLID(s.id) }
+
+// Create an account for the named set of books, unless one with the same currency and title already exists, and save its ID as Save.
+type AccountStep struct {
+	Books    string
+	Currency uint32
+	Title    string
+	Save     string
+
+	id      uint32
+	created bool
+}
+
+func (s *AccountStep) Name() string { return fmt.Sprintf("account %s %s", s.Books, s.Title) }
+
+func (s *AccountStep) Produces() []string { return []string{s.Save} }
+
+func (s *AccountStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *AccountStep) Run(ctx *scenario.Context) error {
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+	if s.id, s.created, err = bw.EnsureAccount(s.Currency, s.Title); err != nil {
+		return err
+	}
+	reuse(s, s.id, s.created)
+	return saveID(ctx, s.Save, s.id)
+}
+
+func (s *AccountStep) Verify(ctx *scenario.Context) error { return verifyLID(s.id) }
+
+// Create a category for the named set of books, unless one with the same symbol already exists.  Its ID is saved as <books>.category.<symbol> unless Save says otherwise.
+type CategoryStep struct {
+	Books  string
+	Symbol string
+	Title  string
+	Save   string
+
+	id      uint32
+	created bool
+}
+
+func (s *CategoryStep) Name() string { return fmt.Sprintf("category %s %s", s.Books, s.Symbol) }
+
+func (s *CategoryStep) Produces() []string {
+	return []string{saveAs(s.Save, s.Books, "category", s.Symbol)}
+}
+
+func (s *CategoryStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *CategoryStep) Run(ctx *scenario.Context) error {
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+	if s.id, s.created, err = bw.EnsureCategory(s.Symbol, s.Title); err != nil {
+		return err
+	}
+	reuse(s, s.id, s.created)
+	return ctx.SetID(saveAs(s.Save, s.Books, "category", s.Symbol), s.id)
+}
+
+func (s *CategoryStep) Verify(ctx *scenario.Context) error { return verifyLID(s.id) }
+
+// Tag an account with a category, unless it's already tagged.  The acctcat's ID is saved as Save.  Nobody cares about the ID itself, but other steps can list it as one of their needs.
+type AcctcatStep struct {
+	Books    string
+	Account  uint32
+	Category uint32
+	Save     string
+
+	id      uint32
+	created bool
+}
+
+func (s *AcctcatStep) Name() string {
+	return fmt.Sprintf("acctcat %s %d %d", s.Books, s.Account, s.Category)
+}
+
+func (s *AcctcatStep) Produces() []string { return []string{s.Save} }
+
+func (s *AcctcatStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *AcctcatStep) Run(ctx *scenario.Context) error {
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+	if s.id, s.created, err = bw.EnsureTag(s.Account, s.Category); err != nil {
+		return err
+	}
+	reuse(s, s.id, s.created)
+	return saveID(ctx, s.Save, s.id)
+}
+
+func (s *AcctcatStep) Verify(ctx *scenario.Context) error { return verifyLID(s.id) }
+
+// Find or create everything in a chart of accounts, described by File, for the named set of books.  File is relative to the scenario file.  The IDs are saved as <books>.currency.<symbol>, <books>.category.<symbol>, <books>.account.<name>, and <books>.acctcat.<account name>.<category symbol>.
+type ChartStep struct {
+	Books string
+	File  string
+
+	dir string // The directory of the scenario file.
+	ids map[string]uint32
+}
+
+func (s *ChartStep) SetScenarioDir(dir string) { s.dir = dir }
+
+// The chart's file name, resolved against the scenario file's directory.
+func (s *ChartStep) path() string {
+	if filepath.IsAbs(s.File) || s.dir == "" {
+		return s.File
+	}
+	return filepath.Join(s.dir, s.File)
+}
+
+func (s *ChartStep) Name() string { return fmt.Sprintf("chart %s %s", s.Books, s.File) }
+
+// If the chart can't be loaded it produces nothing.  Run will say why.
+func (s *ChartStep) Produces() []string {
+	chart, err := bookwerx.LoadChart(s.path())
+	if err != nil {
+		return nil
+	}
+	names := chart.Names()
+	for i, name := range names {
+		names[i] = s.Books + "." + name
+	}
+	return names
+}
+
+func (s *ChartStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *ChartStep) Run(ctx *scenario.Context) error {
+	chart, err := bookwerx.LoadChart(s.path())
+	if err != nil {
+		return err
+	}
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+	s.ids, err = bw.Provision(chart, func(name string, id uint32) error {
+		return ctx.SetID(s.Books+"."+name, id)
+	})
+	return err
+}
+
+func (s *ChartStep) Verify(ctx *scenario.Context) error {
+	for name, id := range s.ids {
+		if err := verifyLID(id); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Post an arbitrary, templated, form body to Bookwerx and save the LastInsertID as Save.  The body must include the apikey.  This is the escape hatch for Bookwerx requests that don't have a step of their own, such as:
+//
+//   - type: post
+//     path: /accounts
+//     body: apikey=${user.apikey}&rarity=0&currency_id=${user.currency.BTC}&title=Cold wallet
+//     save: user.account.ColdWalletBTC
+type PostStep struct {
+	Path string
+	Body string
+	Save string
+
+	id uint32
+}
+
+func (s *PostStep) Name() string { return fmt.Sprintf("post %s", s.Path) }
+
+func (s *PostStep) Produces() []string { return []string{s.Save} }
+
+func (s *PostStep) Run(ctx *scenario.Context) error {
+	form, err := url.ParseQuery(s.Body)
+	if err != nil {
+		return fmt.Errorf("the body is not a valid form: %v", err)
+	}
+	bw, err := ctx.Bookwerx("")
+	if err != nil {
+		return err
+	}
+	if s.id, err = bw.Insert(s.Path, form); err != nil {
+		return err
+	}
+	return saveID(ctx, s.Save, s.id)
+}
+
+func (s *PostStep) Verify(ctx *scenario.Context) error { return verifyLID(s.id) }
+
+// Write the configuration file for the OKCatbox, which uses the named set of books, to File in the run's directory.  Its absolute path is saved as Save.  If the port of ListenAddr is 0 then a free port is used instead and catbox.url is changed to match.
+type CatboxConfigStep struct {
+	File             string
+	Books            string
+	CatDeposit       uint32 `yaml:"cat_deposit"`
+	CatFunding       uint32 `yaml:"cat_funding"`
+	CatHotWallet     uint32 `yaml:"cat_hot_wallet"`
+	CatSpotAvailable uint32 `yaml:"cat_spot_available"`
+	CatSpotHold      uint32 `yaml:"cat_spot_hold"`
+	ListenAddr       string `yaml:"listen_addr"`
+	Save             string
+}
+
+func (s *CatboxConfigStep) Name() string { return fmt.Sprintf("catbox_config %s", s.File) }
+
+func (s *CatboxConfigStep) Produces() []string { return []string{s.Save} }
+
+func (s *CatboxConfigStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+// Build a config file for okcatbox.  You can see that some of the categories are duplicated.  Fix this.
+func (s *CatboxConfigStep) Run(ctx *scenario.Context) error {
+	s.File = ctx.Path(s.File)
+
+	apikey, err := ctx.APIKey(s.Books)
+	if err != nil {
+		return err
+	}
+
+	listenAddr, err := s.listenAddr(ctx)
+	if err != nil {
+		return err
+	}
+	if listenAddr != s.ListenAddr && !ctx.IsDryRun() {
+		if err = ctx.SetCatboxURL(catboxURL(listenAddr)); err != nil {
+			return err
+		}
+	}
+
+	m := make(map[string]AH)
+	m["1"] = AH{
+		Available: s.CatSpotAvailable,
+		Hold:      s.CatSpotHold,
+	}
+	m["6"] = AH{
+		Available: s.CatFunding,
+		Hold:      0, // No Hold variation for funding
+	}
+
+	catboxConfig := Config{
+		Bookwerx: Bookwerx{
+			APIKey:           apikey,
+			Server:           ctx.BookwerxURL,
+			CatDeposit:       s.CatDeposit,
+			CatFunding:       s.CatFunding,
+			CatHotWallet:     s.CatHotWallet,
+			CatSpotAvailable: s.CatSpotAvailable,
+			CatSpotHold:      s.CatSpotHold,
+			TransferCats:     m,
+		},
+		ListenAddr: listenAddr,
+	}
+
+	out, err := yaml.Marshal(catboxConfig)
+	if err != nil {
+		return fmt.Errorf("error marshalling catbox config: %v", err)
+	}
+	err = ctx.WriteFile(s.File, out)
+	if err != nil {
+		return fmt.Errorf("error writing okcatbox config to %s: %v", s.File, err)
+	}
+	if !ctx.IsDryRun() {
+		catboxConfigS, _ := json.MarshalIndent(catboxConfig, "", "  ")
+		fmt.Printf("OKCatbox config=\n%s\n\n", string(catboxConfigS))
+	}
+	return saveString(ctx, s.Save, s.File)
+}
+
+func (s *CatboxConfigStep) Verify(ctx *scenario.Context) error { return verifyFile(s.File) }
+
+// Return ListenAddr, but if its port is 0 then with a free one instead, so that runs on the same machine don't collide and a leftover OKCatbox can't answer for this one.  A dry run doesn't reserve anything.  It plans the OKCatbox at the port of catbox.url, where an exported script then waits for it.
+func (s *CatboxConfigStep) listenAddr(ctx *scenario.Context) (string, error) {
+	host, port, err := net.SplitHostPort(s.ListenAddr)
+	if err != nil {
+		return "", fmt.Errorf("listen_addr %q: %v", s.ListenAddr, err)
+	}
+	if port != "0" {
+		return s.ListenAddr, nil
+	}
+	if ctx.IsDryRun() {
+		u, err := url.Parse(ctx.CatboxURL)
+		if err != nil {
+			return "", fmt.Errorf("cannot parse catbox.url: %v", err)
+		}
+		return net.JoinHostPort(host, u.Port()), nil
+	}
+	l, err := net.Listen("tcp", s.ListenAddr)
+	if err != nil {
+		return "", fmt.Errorf("cannot find a free port for %s: %v", s.ListenAddr, err)
+	}
+	defer l.Close()
+	return net.JoinHostPort(host, strconv.Itoa(l.Addr().(*net.TCPAddr).Port)), nil
+}
+
+// The URL of an OKCatbox that listens at addr.
+func catboxURL(addr string) string {
+	host, port, _ := net.SplitHostPort(addr)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// Start the OKCatbox, in the background, using the given configuration file, and wait until it accepts connections at catbox.url.  Its PID is saved as Save.  It's stopped when oktest exits.
+type CatboxStartStep struct {
+	Config string
+	Save   string
+	Ready  int // How long, in milliseconds, to wait for the OKCatbox to be ready.  The default is 10000.
+}
+
+func (s *CatboxStartStep) Name() string { return fmt.Sprintf("catbox_start %s", s.Config) }
+
+func (s *CatboxStartStep) Produces() []string { return []string{s.Save} }
+
+func (s *CatboxStartStep) Run(ctx *scenario.Context) error {
+	pid, err := s.start(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot start okcatbox: %v", err)
+	}
+	return saveString(ctx, s.Save, pid)
+}
+
+// Run insists that the OKCatbox is ready so there's nothing else to verify.
+func (s *CatboxStartStep) Verify(ctx *scenario.Context) error { return nil }
+
+// Resume starts a fresh OKCatbox for the resumed run to supervise.  The one that the checkpointed run started should have been stopped along with it, so if something still answers at catbox.url that's an error rather than being mistaken for the new OKCatbox.
+func (s *CatboxStartStep) Resume(ctx *scenario.Context) error {
+
+	if !ctx.IsDryRun() {
+		u, err := url.Parse(ctx.CatboxURL)
+		if err != nil {
+			return fmt.Errorf("cannot parse catbox.url: %v", err)
+		}
+		if dial(u.Host) == nil {
+			return fmt.Errorf("something is already listening at %s, perhaps the OKCatbox of the interrupted run.  Stop it and resume again", ctx.CatboxURL)
+		}
+	}
+
+	pid, err := s.start(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot restart okcatbox: %v", err)
+	}
+	if !ctx.IsDryRun() {
+		fmt.Printf("Restarted the OKCatbox as PID %s\n", pid)
+	}
+	if s.Save == "" {
+		return nil
+	}
+	if _, ok := ctx.Vars.Lookup(s.Save); ok {
+		return ctx.Vars.Update(s.Save, pid)
+	}
+	return ctx.Vars.Set(s.Save, pid)
+}
+
+func (s *CatboxStartStep) start(ctx *scenario.Context) (string, error) {
+	deadline := 10000 * time.Millisecond
+	if s.Ready > 0 {
+		deadline = time.Duration(s.Ready) * time.Millisecond
+	}
+
+	// okcatbox -config=okcatbox.yaml &
+	return ctx.Start(ctx.CatboxURL, deadline, "okcatbox", fmt.Sprintf("-config=%s", s.Config))
+}
+
+// Kill the OKCatbox, given by its PID, as abruptly as a crash and start it again with the same configuration file.  The OKCatbox keeps its state in Bookwerx so nothing should be lost or duplicated.  The new PID replaces the old one in Save.
+type CatboxRestartStep struct {
+	PID    string
+	Config string
+	Save   string
+	Ready  int // As for catbox_start.
+}
+
+func (s *CatboxRestartStep) Name() string { return fmt.Sprintf("catbox_restart %s", s.Config) }
+
+func (s *CatboxRestartStep) Consumes() []string { return []string{s.Save} }
+
+func (s *CatboxRestartStep) Run(ctx *scenario.Context) error {
+	if err := ctx.Kill(s.PID); err != nil {
+		return fmt.Errorf("cannot kill okcatbox: %v", err)
+	}
+	if !ctx.IsDryRun() {
+		fmt.Printf("Killed the OKCatbox, PID %s\n", s.PID)
+	}
+
+	start := &CatboxStartStep{Config: s.Config, Ready: s.Ready}
+	pid, err := start.start(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot restart okcatbox: %v", err)
+	}
+	if !ctx.IsDryRun() {
+		fmt.Printf("Restarted the OKCatbox as PID %s\n", pid)
+	}
+	return ctx.Vars.Update(s.Save, pid)
+}
+
+// Run insists that the OKCatbox is ready again so there's nothing else to verify.
+func (s *CatboxRestartStep) Verify(ctx *scenario.Context) error { return nil }
+
+// Does something accept connections at host:port?
+func dial(host string) error {
+	conn, err := net.DialTimeout("tcp", host, time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Get credentials from the OKCatbox, for UserID prefixed with the run ID, and write them to File in the run's directory.  The key is saved as <save>.key and the file's absolute path as <save>.file.
+type CatboxCredentialsStep struct {
+	UserID string `yaml:"user_id"`
+	Kind   string
+	File   string
+	Save   string
+
+	credentials utils.Credentials
+}
+
+func (s *CatboxCredentialsStep) Name() string {
+	return fmt.Sprintf("catbox_credentials %s %s", s.UserID, s.Kind)
+}
+
+func (s *CatboxCredentialsStep) Produces() []string {
+	return []string{s.Save + ".key", s.Save + ".file"}
+}
+
+func (s *CatboxCredentialsStep) Run(ctx *scenario.Context) error {
+	s.File = ctx.Path(s.File)
+	var err error
+	s.credentials, err = buildOKCatboxCredentials(ctx, CredentialsRequestBody{UserID: ctx.Prefix(s.UserID), Type: s.Kind}, s.File)
+	if err != nil {
+		return err
+	}
+	if s.Save == "" {
+		return nil
+	}
+	if err := ctx.Vars.Set(s.Save+".key", s.credentials.Key); err != nil {
+		return err
+	}
+	return ctx.Vars.Set(s.Save+".file", s.File)
+}
+
+func (s *CatboxCredentialsStep) Verify(ctx *scenario.Context) error {
+	if s.credentials.Key == "" {
+		return fmt.Errorf("the OKCatbox returned credentials without a key")
+	}
+	return verifyFile(s.File)
+}
+
+// Write the configuration file for okconnect, which uses the named set of books, to File in the run's directory.  Its absolute path is saved as Save.
+type OKConnectConfigStep struct {
+	File             string
+	Books            string
+	CatDeposit       uint32 `yaml:"cat_deposit"`
+	CatFunding       uint32 `yaml:"cat_funding"`
+	CatSpotAvailable uint32 `yaml:"cat_spot_available"`
+	CatSpotHold      uint32 `yaml:"cat_spot_hold"`
+	Credentials      string // The name of an OKCatbox credentials file.
+	Save             string
+}
+
+func (s *OKConnectConfigStep) Name() string { return fmt.Sprintf("okconnect_config %s", s.File) }
+
+func (s *OKConnectConfigStep) Produces() []string { return []string{s.Save} }
+
+func (s *OKConnectConfigStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *OKConnectConfigStep) Run(ctx *scenario.Context) error {
+	s.File = ctx.Path(s.File)
+
+	apikey, err := ctx.APIKey(s.Books)
+	if err != nil {
+		return err
+	}
+
+	okconnectCfg := config.Config{
+		BookwerxConfig: config.BookwerxConfig{
+			APIKey:           apikey,
+			BaseURL:          ctx.BookwerxURL,
+			CatDeposit:       s.CatDeposit,
+			CatFunding:       s.CatFunding,
+			CatSpotAvailable: s.CatSpotAvailable,
+			CatSpotHold:      s.CatSpotHold,
+		},
+		OKExConfig: config.OKExConfig{
+			Credentials: s.Credentials,
+			BaseURL:     ctx.CatboxURL,
+		},
+	}
+
+	out, err := yaml.Marshal(okconnectCfg)
+	if err != nil {
+		return fmt.Errorf("error marshalling the okconnect config: %v", err)
+	}
+	err = ctx.WriteFile(s.File, out)
+	if err != nil {
+		return fmt.Errorf("error writing the okconnect config to %s: %v", s.File, err)
+	}
+	if !ctx.IsDryRun() {
+		okconnectConfigS, _ := json.MarshalIndent(okconnectCfg, "", "  ")
+		fmt.Printf("okconnect config=\n%s\n\n", string(okconnectConfigS))
+	}
+	return saveString(ctx, s.Save, s.File)
+}
+
+func (s *OKConnectConfigStep) Verify(ctx *scenario.Context) error { return verifyFile(s.File) }
+
+// Create a Bookwerx transaction, and its distributions, for the named set of books.  The distributions must balance and the transaction is posted all or nothing.  The transaction's ID is saved as Save.
+type TransactionStep struct {
+	Books         string
+	Notes         string
+	Time          string
+	Distributions []struct {
+		Account uint32
+		Amount  string // A decimal amount, such as 1.5.  Debits are positive and credits are negative.
+	}
+	Save string
+
+	txid uint32
+}
+
+func (s *TransactionStep) Name() string { return fmt.Sprintf("transaction %s %s", s.Books, s.Notes) }
+
+func (s *TransactionStep) Produces() []string { return []string{s.Save} }
+
+func (s *TransactionStep) Consumes() []string { return []string{s.Books + ".apikey"} }
+
+func (s *TransactionStep) Run(ctx *scenario.Context) error {
+	bw, err := ctx.Bookwerx(s.Books)
+	if err != nil {
+		return err
+	}
+
+	// Check every amount before posting anything.
+	distributions := make([]bookwerx.Distribution, len(s.Distributions))
+	for i, d := range s.Distributions {
+		distributions[i].AccountID = d.Account
+		if distributions[i].Amount, distributions[i].AmountExp, err = bookwerx.ParseDecimal(d.Amount); err != nil {
+			return err
+		}
+	}
+
+	// A dry run can't look up the accounts' currencies, so it can't check that the distributions balance.
+	saved := func(txid uint32) error { return saveID(ctx, s.Save, txid) }
+	if ctx.IsDryRun() {
+		s.txid, err = bw.PostUnchecked(s.Notes, s.Time, distributions, saved)
+	} else {
+		s.txid, err = bw.PostTransaction(s.Notes, s.Time, distributions, saved)
+	}
+	return err
+}
+
+func (s *TransactionStep) Verify(ctx *scenario.Context) error { return verifyLID(s.txid) }
+
+// Assert a deposit with the OKCatbox.  The Apikey is the key of the user's OKCatbox credentials.  It merely identifies the user.  The decimal Quan is saved as Save so that the matching Bookwerx transaction can use exactly the same amount.
+type DepositStep struct {
+	Apikey   string
+	Currency string
+	Quan     string
+	Time     string
+	Save     string
+}
+
+func (s *DepositStep) Name() string { return fmt.Sprintf("deposit %s %s", s.Quan, s.Currency) }
+
+func (s *DepositStep) Produces() []string { return []string{s.Save} }
+
+func (s *DepositStep) Run(ctx *scenario.Context) error {
+	amount, exp, err := bookwerx.ParseDecimal(s.Quan)
+	if err != nil {
+		return err
+	}
+	if err = saveString(ctx, s.Save, bookwerx.FormatDecimal(amount, exp)); err != nil {
+		return err
+	}
+	_, err = PostCatboxDeposit(ctx.HTTPClient, ctx.CatboxURL, DepositRequestBody{
+		Apikey:         s.Apikey,
+		CurrencySymbol: s.Currency,
+		Quan:           s.Quan,
+		Time:           s.Time,
+	})
+	return err
+}
+
+// PostCatboxDeposit insists upon a 200 response so there's nothing else to verify.
+func (s *DepositStep) Verify(ctx *scenario.Context) error { return nil }
+
+// Use okconnect to compare the user's balances in Bookwerx with the corresponding balances in the OKCatbox and verify the number of discrepancies that it finds.  If Reconcile is given then oktest also reconciles the books itself, expects the same number of discrepancies, and requires okconnect to find exactly the ones that it finds.
+type OKConnectCompareStep struct {
+	Config    string
+	Expect    int
+	Reconcile *Reconciliation
+
+	comparison    []compare.Comparison
+	discrepancies []compare.Comparison
+}
+
+func (s *OKConnectCompareStep) Name() string { return fmt.Sprintf("okconnect_compare %s", s.Config) }
+
+func (s *OKConnectCompareStep) Run(ctx *scenario.Context) error {
+
+	out, err := ctx.Output("okconnect", "compare", "-config", s.Config)
+	if err != nil {
+		return fmt.Errorf("cannot execute okconnect: %v", err)
+	}
+
+	if !ctx.IsDryRun() {
+		fmt.Printf("okconnect output=%s\n", out)
+	}
+	s.comparison = make([]compare.Comparison, 0)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&s.comparison)
+	if err != nil {
+		return fmt.Errorf("cannot decode okconnect result: %v", err)
+	}
+
+	if s.Reconcile != nil {
+		if s.discrepancies, err = s.Reconcile.discrepancies(ctx); err != nil {
+			return fmt.Errorf("cannot reconcile the books: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *OKConnectCompareStep) Verify(ctx *scenario.Context) error {
+	if s.Reconcile != nil {
+		if len(s.discrepancies) != s.Expect {
+			return fmt.Errorf("oktest should see %d discrepancies.  Instead it sees %d: %s", s.Expect, len(s.discrepancies), describe(s.discrepancies))
+		}
+		if describe(s.comparison) != describe(s.discrepancies) {
+			return fmt.Errorf("okconnect disagrees with oktest.  okconnect sees %s but oktest sees %s", describe(s.comparison), describe(s.discrepancies))
+		}
+	}
+	if len(s.comparison) != s.Expect {
+		return fmt.Errorf("okconnect should see %d discrepancies.  Instead it sees %d", s.Expect, len(s.comparison))
+	}
+	return nil
+}
+
+func (s *OKConnectCompareStep) Consumes() []string {
+	if s.Reconcile == nil {
+		return nil
+	}
+	return s.Reconcile.consumes()
+}
+
+// Run a series of tests of the given okprobe command using the given OKCatbox credentials files.
+type OKProbeStep struct {
+	Command      string
+	QueryString  string `yaml:"query_string"`
+	Read         string
+	ReadTrade    string `yaml:"read_trade"`
+	ReadWithdraw string `yaml:"read_withdraw"`
+}
+
+func (s *OKProbeStep) Name() string { return fmt.Sprintf("okprobe %s", s.Command) }
+
+func (s *OKProbeStep) Run(ctx *scenario.Context) error {
+	return testOKProbe(ctx, ctx.CatboxURL, s.Command, s.QueryString, s.Read, s.ReadTrade, s.ReadWithdraw)
+}
+
+// testOKProbe insists that every okprobe test succeeds so there's nothing else to verify.
+func (s *OKProbeStep) Verify(ctx *scenario.Context) error { return nil }
+
+// The name to save a result as.  Use save, if given, else <books>.<kind>.<key>.
+func saveAs(save, books, kind, key string) string {
+	if save != "" {
+		return save
+	}
+	return strings.Join([]string{books, kind, key}, ".")
+}
+
+// Say so when a step finds something that already exists instead of creating it.
+func reuse(step scenario.Step, id uint32, created bool) {
+	if !created {
+		fmt.Printf("Reusing %s, ID %d\n", step.Name(), id)
+	}
+}
+
+// Save an ID, unless nobody cares about it.
+func saveID(ctx *scenario.Context, save string, id uint32) error {
+	if save == "" {
+		return nil
+	}
+	return ctx.SetID(save, id)
+}
+
+func saveString(ctx *scenario.Context, save string, value string) error {
+	if save == "" {
+		return nil
+	}
+	return ctx.Vars.Set(save, value)
+}
+
+func verifyLID(id uint32) error {
+	if id == 0 {
+		return fmt.Errorf("Bookwerx did not return a LastInsertID")
+	}
+	return nil
+}
+
+func verifyFile(fileName string) error {
+	if _, err := os.Stat(fileName); err != nil {
+		return fmt.Errorf("expected file is missing: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package supervisor
+
+import (
+	"os"
+	"syscall"
+)
+
+// Start the process as the leader of a new process group.
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Signal the whole process group.
+func terminate(p *os.Process) error { return syscall.Kill(-p.Pid, syscall.SIGTERM) }
+
+func kill(p *os.Process) error { return syscall.Kill(-p.Pid, syscall.SIGKILL) }
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package supervisor
+
+import (
+	"os"
+	"syscall"
+)
+
+// Windows has no process groups to signal, so only the process itself is stopped.
+func sysProcAttr() *syscall.SysProcAttr { return nil }
+
+func terminate(p *os.Process) error { return p.Kill() }
+
+func kill(p *os.Process) error { return p.Kill() }
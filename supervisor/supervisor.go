@@ -0,0 +1,208 @@
+// Package supervisor runs child processes, such as the OKCatbox, on behalf of a test run.  Each one is started in its own process group so that it can be terminated together with anything that it starts, its standard error is kept so that an early exit can be explained, and it can be waited on until it's ready.
+package supervisor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a process gets to exit after it's asked to, before it's killed.
+const grace = 5 * time.Second
+
+// How much of a process' standard error is kept.
+const keep = 8192
+
+// A Process is a supervised child process.
+type Process struct {
+	Name string
+
+	cmd    *exec.Cmd
+	stderr *tail
+	done   chan struct{}
+	err    error // Why the process exited, once done is closed.
+}
+
+// Start starts the named program in its own process group.  Its standard output and standard error are appended to logFile or, if that's empty, passed through to ours.
+func Start(logFile string, name string, arg ...string) (*Process, error) {
+	p := &Process{Name: name, stderr: &tail{}, done: make(chan struct{})}
+	var stdout io.Writer = os.Stdout
+	var stderr io.Writer = os.Stderr
+	var log *os.File
+	if logFile != "" {
+		var err error
+		if log, err = os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+			return nil, err
+		}
+		stdout, stderr = log, log
+	}
+	p.cmd = exec.Command(name, arg...)
+	p.cmd.Stdout = stdout
+	p.cmd.Stderr = io.MultiWriter(stderr, p.stderr)
+	p.cmd.SysProcAttr = sysProcAttr()
+	if err := p.cmd.Start(); err != nil {
+		if log != nil {
+			_ = log.Close()
+		}
+		return nil, err
+	}
+	go func() {
+		p.err = p.cmd.Wait()
+		if log != nil {
+			_ = log.Close()
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Pid returns the process ID, which is also the ID of its process group.
+func (p *Process) Pid() int { return p.cmd.Process.Pid }
+
+// Exited returns true, and the reason, if the process has exited.
+func (p *Process) Exited() (bool, error) {
+	select {
+	case <-p.done:
+		return true, p.err
+	default:
+		return false, nil
+	}
+}
+
+// Stderr returns the end of what the process wrote to its standard error.
+func (p *Process) Stderr() string { return p.stderr.String() }
+
+// WaitReady calls ready, every interval, until it succeeds.  It fails if the process exits first, with its standard error, or if ready still fails after the deadline, with ready's last error.  Something else, such as a leftover process on the same port, may be what made ready succeed, so the process must also still be running then, and one interval later.
+func (p *Process) WaitReady(ready func() error, deadline, interval time.Duration) error {
+	timeout := time.After(deadline)
+	for {
+		err := ready()
+		if err == nil {
+			if exited, _ := p.Exited(); exited {
+				return p.exitError("although something is ready in its place")
+			}
+			time.Sleep(interval)
+			if exited, _ := p.Exited(); exited {
+				return p.exitError("right after it was ready")
+			}
+			return nil
+		}
+		select {
+		case <-p.done:
+			return p.exitError("before it was ready")
+		case <-timeout:
+			return fmt.Errorf("%s is not ready after %v: %v", p.Name, deadline, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Stop asks the process group to terminate, and kills it if it doesn't within a grace period.  It waits for the process to exit.
+func (p *Process) Stop() {
+	if exited, _ := p.Exited(); exited {
+		return
+	}
+	_ = terminate(p.cmd.Process)
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+		_ = kill(p.cmd.Process)
+		<-p.done
+	}
+}
+
+// Kill kills the process group at once, as abruptly as a crash, and waits for the process to exit.
+func (p *Process) Kill() {
+	if exited, _ := p.Exited(); exited {
+		return
+	}
+	_ = kill(p.cmd.Process)
+	<-p.done
+}
+
+func (p *Process) exitError(when string) error {
+	msg := fmt.Sprintf("%s exited %s: %v", p.Name, when, p.err)
+	if stderr := strings.TrimSpace(p.Stderr()); stderr != "" {
+		msg += "\n" + stderr
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// A Group is every Process started through it, so that they can all be stopped at once, even from a signal handler.
+type Group struct {
+	mu        sync.Mutex
+	processes []*Process
+	stopped   bool
+}
+
+// Start starts a Process in the group.  Once the group has been stopped nothing more can be started.
+func (g *Group) Start(logFile string, name string, arg ...string) (*Process, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		return nil, fmt.Errorf("cannot start %s because everything is being stopped", name)
+	}
+	p, err := Start(logFile, name, arg...)
+	if err != nil {
+		return nil, err
+	}
+	g.processes = append(g.processes, p)
+	return p, nil
+}
+
+// Kill kills the Process in the group that has the given PID and removes it from the group.
+func (g *Group) Kill(pid int) error {
+	g.mu.Lock()
+	var p *Process
+	for i, q := range g.processes {
+		if q.Pid() == pid {
+			p = q
+			g.processes = append(g.processes[:i], g.processes[i+1:]...)
+			break
+		}
+	}
+	g.mu.Unlock()
+	if p == nil {
+		return fmt.Errorf("process %d was not started here", pid)
+	}
+	p.Kill()
+	return nil
+}
+
+// Stop stops every Process in the group, most recently started first.
+func (g *Group) Stop() {
+	g.mu.Lock()
+	g.stopped = true
+	processes := g.processes
+	g.processes = nil
+	g.mu.Unlock()
+	for i := len(processes) - 1; i >= 0; i-- {
+		processes[i].Stop()
+	}
+}
+
+// A tail keeps the last bytes written to it.
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tail) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, b...)
+	if len(t.buf) > keep {
+		t.buf = append([]byte{}, t.buf[len(t.buf)-keep:]...)
+	}
+	return len(b), nil
+}
+
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
@@ -0,0 +1,146 @@
+//go:build !windows
+// +build !windows
+
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var errNotReady = errors.New("not ready")
+
+func notReady() error { return errNotReady }
+
+func TestEarlyExit(t *testing.T) {
+	p, err := Start(filepath.Join(tempDir(t), "early.log"), "sh", "-c", "echo cannot listen >&2; exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.WaitReady(notReady, 5*time.Second, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "before it was ready") || !strings.Contains(err.Error(), "cannot listen") {
+		t.Errorf("expected an early exit with the standard error, got %v", err)
+	}
+}
+
+func TestReadyButExited(t *testing.T) {
+	// Something else, such as a leftover process on the same port, is ready while the process itself fails.
+	p, err := Start(filepath.Join(tempDir(t), "ready.log"), "sh", "-c", "sleep 0.05; echo address in use >&2; exit 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.WaitReady(func() error { return nil }, 5*time.Second, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "address in use") {
+		t.Errorf("expected the exit to be noticed although ready succeeded, got %v", err)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	p, err := Start("", "sleep", "30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	err = p.WaitReady(notReady, 100*time.Millisecond, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "not ready after") || !strings.Contains(err.Error(), errNotReady.Error()) {
+		t.Errorf("expected a missed deadline with ready's last error, got %v", err)
+	}
+	if exited, _ := p.Exited(); exited {
+		t.Errorf("a missed deadline should leave the process alone")
+	}
+}
+
+// Is the process with the given PID gone?  An orphan may take a moment to be reaped, so a zombie counts as gone.
+func gone(pid int) bool {
+	for i := 0; i < 100; i++ {
+		if syscall.Kill(pid, 0) == syscall.ESRCH {
+			return true
+		}
+		if stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+			if fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:])); len(fields) > 0 && fields[0] == "Z" {
+				return true
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+// Return a new temporary directory that's removed after the test.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "supervisor-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+// Start a shell, in g, that starts a sleep of its own and ignores SIGTERM.  Return the shell and the PID of the sleep.
+func startFamily(t *testing.T, g *Group) (*Process, int) {
+	pidFile := filepath.Join(tempDir(t), "child.pid")
+	p, err := g.Start("", "sh", "-c", "trap '' TERM; sleep 30 & echo $! > "+pidFile+"; wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.WaitReady(func() error {
+		_, err := ioutil.ReadFile(pidFile)
+		return err
+	}, 5*time.Second, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, child
+}
+
+func TestGroupStop(t *testing.T) {
+	var g Group
+	p, child := startFamily(t, &g)
+	g.Stop()
+	if exited, _ := p.Exited(); !exited {
+		t.Errorf("the shell is still running")
+	}
+	if !gone(child) {
+		t.Errorf("the shell's child, PID %d, is still running", child)
+		_ = syscall.Kill(child, syscall.SIGKILL)
+	}
+	if _, err := g.Start("", "sleep", "30"); err == nil {
+		t.Errorf("started a process after the group was stopped")
+	}
+}
+
+func TestGroupKill(t *testing.T) {
+	var g Group
+	defer g.Stop()
+	p, child := startFamily(t, &g)
+	if err := g.Kill(p.Pid()); err != nil {
+		t.Fatal(err)
+	}
+	if exited, _ := p.Exited(); !exited {
+		t.Errorf("the shell is still running")
+	}
+	if !gone(child) {
+		t.Errorf("the shell's child, PID %d, is still running", child)
+		_ = syscall.Kill(child, syscall.SIGKILL)
+	}
+	if err := g.Kill(p.Pid()); err == nil {
+		t.Errorf("killed PID %d twice", p.Pid())
+	}
+}